@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// defaultCacheTTL is how long cached replies are reused unless --cache-ttl says otherwise.
+const defaultCacheTTL = 7 * 24 * time.Hour
+
+// cacheVersion is part of every key; bump it when the stored format or the way
+// requests are built changes incompatibly.
+const cacheVersion = "v1"
+
+// ReviewCache stores LLM replies on disk, keyed by a hash of the provider, model and
+// full request (prompt and chunk content), so re-running a review only sends the
+// chunks that changed. A nil ReviewCache caches nothing.
+type ReviewCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	Created  time.Time `json:"created"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Content  string    `json:"content"`
+	// Usage is what the original request cost; replies served from the cache cost nothing.
+	Usage Usage `json:"usage"`
+}
+
+// NewReviewCache returns a cache in dir whose entries expire after ttl (never if 0).
+func NewReviewCache(dir string, ttl time.Duration) *ReviewCache {
+	return &ReviewCache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// defaultCacheDir is reviewer/ under the user cache directory, or .reviewer-cache
+// when there is none.
+func defaultCacheDir() string {
+	if d, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(d, "reviewer")
+	}
+	return ".reviewer-cache"
+}
+
+// cacheKey hashes everything that determines a reply: the backend, the model and
+// the request.
+func cacheKey(provider, model string, req ChatRequest) string {
+	h := sha256.New()
+	for _, s := range []string{cacheVersion, provider, model, req.System, req.User, string(req.Schema), strconv.Itoa(req.MaxTokens)} {
+		// Length-prefix each field so adjacent fields cannot run into each other.
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *ReviewCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *ReviewCache) expired(e cacheEntry) bool {
+	return c.ttl > 0 && c.now().Sub(e.Created) > c.ttl
+}
+
+// Get returns the unexpired entry stored under key.
+func (c *ReviewCache) Get(key string) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || c.expired(e) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// Put stores e under key. The file is written to a temporary name and renamed, so
+// concurrent workers and readers never see a partial entry.
+func (c *ReviewCache) Put(key string, e cacheEntry) error {
+	if c == nil {
+		return nil
+	}
+	if e.Created.IsZero() {
+		e.Created = c.now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Prune removes expired and unreadable entries, or every entry when all is set,
+// and returns how many it removed.
+func (c *ReviewCache) Prune(all bool) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !all && filepath.Ext(path) == ".json" {
+			if b, err := os.ReadFile(path); err == nil {
+				var e cacheEntry
+				if json.Unmarshal(b, &e) == nil && !c.expired(e) {
+					return nil
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+	// Drop the shard directories that are now empty; Remove fails on the others.
+	if shards, err := os.ReadDir(c.dir); err == nil {
+		for _, s := range shards {
+			if s.IsDir() {
+				_ = os.Remove(filepath.Join(c.dir, s.Name()))
+			}
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReviewCache_GetPutExpiry(t *testing.T) {
+	c := NewReviewCache(t.TempDir(), time.Hour)
+	req := ChatRequest{System: "review", User: "code", MaxTokens: 100}
+	key := cacheKey("openai", "gpt-4o", req)
+	if _, ok := c.Get(key); ok {
+		t.Fatal("empty cache should miss")
+	}
+	if err := c.Put(key, cacheEntry{Content: "looks good"}); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := c.Get(key); !ok || e.Content != "looks good" {
+		t.Errorf("expected hit, got %+v %v", e, ok)
+	}
+	for _, other := range []string{
+		cacheKey("openai", "gpt-4o-mini", req),
+		cacheKey("openai", "gpt-4o", ChatRequest{System: "review", User: "code2", MaxTokens: 100}),
+		cacheKey("openai", "gpt-4o", ChatRequest{System: "review", User: "code", MaxTokens: 100, Schema: findingsSchema}),
+	} {
+		if other == key {
+			t.Error("different requests must not share a key")
+		}
+	}
+
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, ok := c.Get(key); ok {
+		t.Error("expired entry should miss")
+	}
+	n, err := c.Prune(false)
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 pruned entry, got %d (%v)", n, err)
+	}
+}
+
+func TestReviewCache_PruneAll(t *testing.T) {
+	c := NewReviewCache(t.TempDir(), 0)
+	for i := 0; i < 3; i++ {
+		if err := c.Put(cacheKey("p", "m", ChatRequest{User: fmt.Sprint(i)}), cacheEntry{Content: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := c.Prune(false); err != nil || n != 0 {
+		t.Errorf("entries without TTL should be kept, pruned %d (%v)", n, err)
+	}
+	if n, err := c.Prune(true); err != nil || n != 3 {
+		t.Errorf("expected 3 pruned entries, got %d (%v)", n, err)
+	}
+	if n, err := NewReviewCache(t.TempDir()+"/missing", 0).Prune(true); err != nil || n != 0 {
+		t.Errorf("missing cache dir: %d %v", n, err)
+	}
+}
+
+func TestReviewAndFixLoop_CachedRerun(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	p := &fakeProvider{delay: func(string) time.Duration { return 0 }}
+	l := &LLMClient{provider: p}
+	l.EnableCache(NewReviewCache(t.TempDir(), time.Hour))
+	chunks := []Chunk{{File: "a.go", Content: "code-0"}, {File: "a.go", Content: "code-1"}}
+	opts := ReviewOptions{ChunkTimeout: time.Second, MaxRetries: 1, Concurrency: 1}
+
+	if err := l.ReviewAndFixLoop(context.Background(), testLoopConfig(), "go", chunks, opts, NewReport("test", "fake", "fake-model")); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 4 {
+		t.Fatalf("first run should send review and test requests, sent %d", p.calls)
+	}
+	chunks[1].Content = "code-2"
+	report := NewReport("test", "fake", "fake-model")
+	if err := l.ReviewAndFixLoop(context.Background(), testLoopConfig(), "go", chunks, opts, report); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 6 {
+		t.Errorf("only the changed chunk should be sent again, total calls %d", p.calls)
+	}
+	results := report.Results()
+	if !results[0].Cached || results[0].Usage.Total() != 0 || results[0].Review != "reply for code-0" {
+		t.Errorf("unchanged chunk should come from the cache at no cost: %+v", results[0])
+	}
+	if results[1].Cached {
+		t.Errorf("changed chunk should not be cached: %+v", results[1])
+	}
+}
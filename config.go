@@ -1,22 +1,95 @@
 package main
 
 import (
+	"fmt"
 	"os"
+
 	"github.com/pelletier/go-toml/v2"
 )
 
+// LanguageConfig describes a language under [languages.<name>]. Languages are
+// entirely config-driven: adding a section is enough to review a new one.
 type LanguageConfig struct {
-	Extension    string `toml:"extension"`
-	ReviewPrompt string `toml:"review_prompt"`
-	TestPrompt   string `toml:"test_prompt"`
+	// Name is the key of the section; it is set by Config.Language.
+	Name string `toml:"-"`
+	// Extensions are the file suffixes of the language, e.g. [".ts", ".tsx"].
+	Extensions []string `toml:"extensions"`
+	// Extension is the single-suffix form of Extensions.
+	Extension string `toml:"extension"`
+	// Filenames match whole file names without a telling extension, e.g. "Makefile".
+	Filenames []string `toml:"filenames"`
+	// Interpreters match the shebang of extensionless scripts, e.g. ["python"]
+	// also matches "#!/usr/bin/env python3".
+	Interpreters []string `toml:"interpreters"`
+	ReviewPrompt string   `toml:"review_prompt"`
+	TestPrompt   string   `toml:"test_prompt"`
+	// Fence is the code fence tag used in prompts; the language name by default.
+	Fence string `toml:"fence"`
+	// TestFile names generated test files; see LanguageConfig.TestFileName.
+	TestFile string `toml:"test_file"`
+	// TestDir is where generated tests are written, relative to --dir.
+	TestDir string `toml:"test_dir"`
+	// TestCommand runs the tests in --dir, e.g. ["go", "test", "./..."].
+	TestCommand []string `toml:"test_command"`
+}
+
+// LLMConfig holds connection settings for the LLM endpoint: gateways, auth and TLS.
+type LLMConfig struct {
+	BaseURL    string            `toml:"base_url"`
+	Headers    map[string]string `toml:"headers"`
+	APIKeyEnv  string            `toml:"api_key_env"`
+	APIVersion string            `toml:"api_version"`
+	OrgID      string            `toml:"org_id"`
+	Proxy      string            `toml:"proxy"`
+	TLS        TLSConfig         `toml:"tls"`
+	// MaxConcurrency caps parallel requests, overriding the provider default.
+	MaxConcurrency int `toml:"max_concurrency"`
+	// RequestsPerMinute and TokensPerMinute rate-limit requests client-side; 0 means
+	// no limit. Tokens are estimated prompt tokens plus the reply budget.
+	RequestsPerMinute int `toml:"requests_per_minute"`
+	TokensPerMinute   int `toml:"tokens_per_minute"`
+}
+
+// TLSConfig configures custom CAs and client certificates (mTLS) for the LLM endpoint.
+type TLSConfig struct {
+	CAFile             string `toml:"ca_file"`
+	CertFile           string `toml:"cert_file"`
+	KeyFile            string `toml:"key_file"`
+	ServerName         string `toml:"server_name"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+}
+
+// AzureConfig switches the openai provider to Azure OpenAI when Endpoint is set.
+type AzureConfig struct {
+	Endpoint   string `toml:"endpoint"`
+	Deployment string `toml:"deployment"`
+	APIVersion string `toml:"api_version"`
+	APIKeyEnv  string `toml:"api_key_env"`
+}
+
+// OllamaConfig holds options specific to the ollama provider.
+type OllamaConfig struct {
+	BaseURL     string `toml:"base_url"`
+	NumCtx      int    `toml:"num_ctx"`
+	KeepAlive   string `toml:"keep_alive"`
+	PullMissing bool   `toml:"pull_missing"`
 }
 
 type Config struct {
-	Model       string                       `toml:"model"`
-	ChunkSize   int                          `toml:"chunk_size"`
-	LLMProvider string                       `toml:"llm_provider"`
-	LLMModel    string                       `toml:"llm_model"`
-	Languages   map[string]LanguageConfig    `toml:"languages"`
+	Model       string                    `toml:"model"`
+	ChunkSize   int                       `toml:"chunk_size"`
+	LLMProvider string                    `toml:"llm_provider"`
+	LLMModel    string                    `toml:"llm_model"`
+	LLM         LLMConfig                 `toml:"llm"`
+	Azure       AzureConfig               `toml:"azure"`
+	Ollama      OllamaConfig              `toml:"ollama"`
+	Models      map[string]ModelLimits    `toml:"models"`
+	Prices      map[string]Price          `toml:"prices"`
+	Languages   map[string]LanguageConfig `toml:"languages"`
+	// Include and Exclude are gitignore-style globs, relative to --dir, that select
+	// the files to review on top of .gitignore and .reviewerignore.
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -29,5 +102,10 @@ func LoadConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	for name, lc := range cfg.Languages {
+		if len(lc.Exts()) == 0 && len(lc.Filenames) == 0 && len(lc.Interpreters) == 0 {
+			return nil, fmt.Errorf("languages.%s: set extensions, filenames or interpreters", name)
+		}
+	}
 	return &cfg, nil
 }
@@ -1,24 +1,27 @@
 package main
 
 import (
-	"io/fs"
+	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 )
 
+// GetUncommittedDiff returns the uncommitted changes under dir. Like every diff
+// here, it is run in dir with --relative, so its paths are relative to dir rather
+// than to the repository root.
 func GetUncommittedDiff(dir string) (string, error) {
-	cmd := exec.Command("git", "diff", "--unified=3", dir)
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(out), nil
+	return gitDiff(dir, "--unified=3")
 }
 
+// GetBranchDiff returns the changes under dir between base and HEAD.
 func GetBranchDiff(dir, base string) (string, error) {
-	cmd := exec.Command("git", "diff", base+"...HEAD", "--unified=3", dir)
+	return gitDiff(dir, base+"...HEAD", "--unified=3")
+}
+
+func gitDiff(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"diff", "--relative"}, args...)...)
+	cmd.Dir = dir
 	out, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -26,62 +29,178 @@ func GetBranchDiff(dir, base string) (string, error) {
 	return string(out), nil
 }
 
-func GetProjectChunks(dir string, chunkSize int, extensions []string) ([]string, error) {
-	var chunks []string
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return err
-		}
-		for _, ext := range extensions {
-			if strings.HasSuffix(path, ext) {
-				data, err := os.ReadFile(path)
-				if err != nil {
-					return err
-				}
-				lines := strings.Split(string(data), "\n")
-				for i := 0; i < len(lines); i += chunkSize {
-					end := i + chunkSize
-					if end > len(lines) {
-						end = len(lines)
-					}
-					chunk := strings.Join(lines[i:end], "\n")
-					chunks = append(chunks, chunk)
-				}
-			}
-		}
-		return nil
-	})
-	return chunks, err
+// Chunk is a piece of code sent to the LLM in a single request. StartLine and
+// EndLine are 1-based line numbers in File; for diff chunks they span the new-file
+// lines covered by the chunk's hunks.
+type Chunk struct {
+	File      string
+	StartLine int
+	EndLine   int
+	Content   string
+	// Prelude is context shown before Content, starting at line 1 of File (e.g.
+	// the package clause and imports of a Go file).
+	Prelude string
+	// Header and Hunks are set for diff chunks and drive line-number mapping.
+	// Deleted marks chunks of removed files, whose lines only exist on the old side.
+	Header  []string
+	Hunks   []Hunk
+	Deleted bool
+}
+
+// Text returns the chunk as sent for test generation: prelude followed by content.
+func (c Chunk) Text() string {
+	if c.Prelude == "" {
+		return c.Content
+	}
+	return c.Prelude + "\n\n// ...\n\n" + c.Content
 }
 
-func GetFileChunks(path string, chunkSize int) ([]string, error) {
+// GetFileChunks splits a file into chunks that fit the budget. Go files are split
+// on top-level declarations; other files, and Go files that do not parse, are
+// split every chunkSize lines.
+func GetFileChunks(path string, budget ChunkBudget) ([]Chunk, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	chunkSize := budget.LinesFor(len(data), strings.Count(string(data), "\n")+1)
+	if strings.HasSuffix(path, ".go") {
+		chunks, err := ChunkGoSource(path, data, chunkSize)
+		if err == nil {
+			return chunks, nil
+		}
+		fmt.Fprintf(os.Stderr, "[!] Could not parse %s, chunking by lines: %v\n", path, err)
+	}
+	return chunkLines(path, data, chunkSize), nil
+}
+
+func chunkLines(path string, data []byte, chunkSize int) []Chunk {
 	lines := strings.Split(string(data), "\n")
-	var chunks []string
+	var chunks []Chunk
 	for i := 0; i < len(lines); i += chunkSize {
 		end := i + chunkSize
 		if end > len(lines) {
 			end = len(lines)
 		}
-		chunk := strings.Join(lines[i:end], "\n")
-		chunks = append(chunks, chunk)
+		chunks = append(chunks, Chunk{
+			File:      path,
+			StartLine: i + 1,
+			EndLine:   end,
+			Content:   strings.Join(lines[i:end], "\n"),
+		})
 	}
-	return chunks, nil
+	return chunks
 }
 
-func ChunkDiff(diff string, chunkSize int) []string {
+// ChunkDiff splits a diff into chunks on hunk boundaries. Every chunk covers a
+// single file and starts with that file's headers; hunks larger than the budget
+// are split with recomputed "@@" headers. Binary files and files without hunks
+// (pure renames or mode changes) are skipped. If the diff cannot be parsed it
+// falls back to line-based chunking.
+func ChunkDiff(diff string, budget ChunkBudget) []Chunk {
+	files, err := ParseDiff(diff)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] Could not parse diff (%v), falling back to line-based chunking\n", err)
+		return chunkDiffLines(diff, budget.LinesFor(len(diff), strings.Count(diff, "\n")+1))
+	}
+	var chunks []Chunk
+	for i := range files {
+		f := &files[i]
+		chars, lines := 0, len(f.Header)
+		for _, h := range f.Hunks {
+			lines += len(h.Lines) + 1
+			for _, l := range h.Lines {
+				chars += len(l.Text) + 2
+			}
+		}
+		chunks = append(chunks, chunkFileDiff(f, budget.LinesFor(chars, lines))...)
+	}
+	return chunks
+}
+
+func chunkFileDiff(f *FileDiff, chunkSize int) []Chunk {
+	if f.IsBinary || len(f.Hunks) == 0 {
+		return nil
+	}
+	header := strings.Join(f.Header, "\n")
+	budget := chunkSize - len(f.Header) - 1
+	if budget < 1 {
+		budget = 1
+	}
+	var chunks []Chunk
+	var parts []Hunk
+	lines := 0
+	flush := func() {
+		if len(parts) == 0 {
+			return
+		}
+		var b strings.Builder
+		b.WriteString(header)
+		start, end := 0, 0
+		for _, h := range parts {
+			b.WriteString("\n")
+			b.WriteString(h.String())
+			s, e := h.NewRange()
+			if f.IsDeleted {
+				s, e = h.OldRange()
+			}
+			if start == 0 || s < start {
+				start = s
+			}
+			if e > end {
+				end = e
+			}
+		}
+		chunks = append(chunks, Chunk{
+			File:      f.Path(),
+			StartLine: start,
+			EndLine:   end,
+			Content:   b.String(),
+			Header:    f.Header,
+			Hunks:     parts,
+			Deleted:   f.IsDeleted,
+		})
+		parts, lines = nil, 0
+	}
+	for _, hunk := range f.Hunks {
+		for _, part := range splitHunk(hunk, budget) {
+			size := len(part.Lines) + 1
+			if lines > 0 && lines+size > budget+1 {
+				flush()
+			}
+			parts = append(parts, part)
+			lines += size
+		}
+	}
+	flush()
+	return chunks
+}
+
+// chunkDiffLines splits an unparsable diff every chunkSize lines. Positions in the
+// raw diff are not lines of any file, so the chunks carry no line numbers: they are
+// sent without a line gutter and their findings are not mapped to lines.
+func chunkDiffLines(diff string, chunkSize int) []Chunk {
 	lines := strings.Split(diff, "\n")
-	var chunks []string
+	var chunks []Chunk
+	file := ""
 	for i := 0; i < len(lines); i += chunkSize {
 		end := i + chunkSize
 		if end > len(lines) {
 			end = len(lines)
 		}
-		chunk := strings.Join(lines[i:end], "\n")
-		chunks = append(chunks, chunk)
+		chunkFile := file
+		for _, line := range lines[i:end] {
+			if strings.HasPrefix(line, "+++ b/") {
+				file = strings.TrimPrefix(line, "+++ b/")
+				if chunkFile == "" {
+					chunkFile = file
+				}
+			}
+		}
+		chunks = append(chunks, Chunk{
+			File:    chunkFile,
+			Content: strings.Join(lines[i:end], "\n"),
+		})
 	}
 	return chunks
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileDiff is the part of a unified diff that describes changes to one file.
+type FileDiff struct {
+	OldPath string
+	NewPath string
+	// Header holds the "diff --git" line and every extended header line up to
+	// and including "+++", exactly as they appeared in the diff.
+	Header    []string
+	IsNew     bool
+	IsDeleted bool
+	IsRename  bool
+	IsCopy    bool
+	IsBinary  bool
+	OldMode   string
+	NewMode   string
+	Hunks     []Hunk
+}
+
+// Hunk is a single "@@" section of a file diff.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Section  string
+	Lines    []DiffLine
+}
+
+// DiffLine is one line of a hunk. Kind is ' ', '+', '-' or '\' (for "\ No newline
+// at end of file"). OldLine and NewLine are the 1-based line numbers on each side,
+// or 0 when the line does not exist on that side.
+type DiffLine struct {
+	Kind    byte
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Path returns the path of the file after the change, or before it for deletions.
+func (f *FileDiff) Path() string {
+	if f.IsDeleted || f.NewPath == "" {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// ParseDiff parses the output of git diff (or any unified diff) into per-file,
+// per-hunk structure.
+func ParseDiff(diff string) ([]FileDiff, error) {
+	var files []FileDiff
+	var cur *FileDiff
+	var hunk *Hunk
+	oldLeft, newLeft := 0, 0
+	oldLine, newLine := 0, 0
+
+	startFile := func(header string) {
+		files = append(files, FileDiff{Header: []string{header}})
+		cur = &files[len(files)-1]
+		hunk = nil
+	}
+
+	lines := strings.Split(diff, "\n")
+	for n, line := range lines {
+		// Inside a hunk, line counts decide where it ends, so "--- foo" can be a removed line.
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			kind := byte(' ')
+			text := line
+			if line != "" {
+				kind, text = line[0], line[1:]
+			}
+			dl := DiffLine{Kind: kind, Text: text}
+			switch kind {
+			case ' ':
+				dl.OldLine, dl.NewLine = oldLine, newLine
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+			case '-':
+				dl.OldLine = oldLine
+				oldLine++
+				oldLeft--
+			case '+':
+				dl.NewLine = newLine
+				newLine++
+				newLeft--
+			case '\\':
+			default:
+				return nil, fmt.Errorf("diff line %d: unexpected line in hunk: %q", n+1, line)
+			}
+			hunk.Lines = append(hunk.Lines, dl)
+			continue
+		}
+		if hunk != nil && strings.HasPrefix(line, `\`) {
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: '\\', Text: line[1:]})
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			startFile(line)
+			cur.OldPath, cur.NewPath = splitGitPaths(strings.TrimPrefix(line, "diff --git "))
+		case strings.HasPrefix(line, "--- ") && (cur == nil || len(cur.Hunks) > 0):
+			// Plain unified diff without a "diff --git" line.
+			startFile(line)
+			cur.OldPath = diffPath(strings.TrimPrefix(line, "--- "))
+			cur.IsNew = cur.OldPath == ""
+		case cur == nil:
+			// Preamble before the first file (e.g. commit message); ignore.
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("diff line %d: malformed hunk header: %q", n+1, line)
+			}
+			h := Hunk{
+				OldStart: atoiDefault(m[1], 0),
+				OldLines: atoiDefault(m[2], 1),
+				NewStart: atoiDefault(m[3], 0),
+				NewLines: atoiDefault(m[4], 1),
+				Section:  m[5],
+			}
+			cur.Hunks = append(cur.Hunks, h)
+			hunk = &cur.Hunks[len(cur.Hunks)-1]
+			oldLeft, newLeft = h.OldLines, h.NewLines
+			oldLine, newLine = h.OldStart, h.NewStart
+		case len(cur.Hunks) > 0:
+			if line != "" {
+				return nil, fmt.Errorf("diff line %d: unexpected line after hunk: %q", n+1, line)
+			}
+		default:
+			cur.Header = append(cur.Header, line)
+			parseExtendedHeader(cur, line)
+		}
+	}
+	return files, nil
+}
+
+func parseExtendedHeader(f *FileDiff, line string) {
+	switch {
+	case strings.HasPrefix(line, "--- "):
+		if p := diffPath(strings.TrimPrefix(line, "--- ")); p != "" {
+			f.OldPath = p
+		} else {
+			f.IsNew = true
+		}
+	case strings.HasPrefix(line, "+++ "):
+		if p := diffPath(strings.TrimPrefix(line, "+++ ")); p != "" {
+			f.NewPath = p
+		} else {
+			f.IsDeleted = true
+		}
+	case strings.HasPrefix(line, "new file mode "):
+		f.IsNew = true
+		f.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		f.IsDeleted = true
+		f.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		f.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		f.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "rename from "):
+		f.IsRename = true
+		f.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		f.IsRename = true
+		f.NewPath = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		f.IsCopy = true
+		f.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		f.IsCopy = true
+		f.NewPath = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+		f.IsBinary = true
+	}
+}
+
+// splitGitPaths splits the "a/old b/new" part of a "diff --git" line. Paths may
+// contain spaces, so for unquoted input it relies on both sides being equal in
+// length for non-renames; renames are corrected later by "rename from/to".
+func splitGitPaths(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		if end := closingQuote(s); end > 0 {
+			return diffPath(s[:end+1]), diffPath(strings.TrimSpace(s[end+1:]))
+		}
+	}
+	if len(s)%2 == 1 {
+		mid := len(s) / 2
+		if s[mid] == ' ' && strings.HasPrefix(s[mid+1:], "b/") {
+			return diffPath(s[:mid]), diffPath(s[mid+1:])
+		}
+	}
+	if i := strings.Index(s, " b/"); i >= 0 {
+		return diffPath(s[:i]), diffPath(s[i+1:])
+	}
+	return diffPath(s), diffPath(s)
+}
+
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// diffPath strips the a/ or b/ prefix and any trailing tab-separated timestamp,
+// returning "" for /dev/null.
+func diffPath(p string) string {
+	if i := strings.IndexByte(p, '\t'); i >= 0 {
+		p = p[:i]
+	}
+	p = unquotePath(strings.TrimSpace(p))
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		return p[2:]
+	}
+	return p
+}
+
+func unquotePath(p string) string {
+	if strings.HasPrefix(p, `"`) {
+		if u, err := strconv.Unquote(p); err == nil {
+			return u
+		}
+	}
+	return p
+}
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// String renders the hunk back to unified diff text, including its "@@" header.
+func (h Hunk) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	if h.Section != "" {
+		b.WriteString(" " + h.Section)
+	}
+	for _, l := range h.Lines {
+		b.WriteByte('\n')
+		b.WriteByte(l.Kind)
+		b.WriteString(l.Text)
+	}
+	return b.String()
+}
+
+// NewRange returns the first and last new-file line touched by the hunk.
+func (h Hunk) NewRange() (int, int) {
+	if h.NewLines == 0 {
+		return h.NewStart, h.NewStart
+	}
+	return h.NewStart, h.NewStart + h.NewLines - 1
+}
+
+// OldRange returns the first and last old-file line touched by the hunk.
+func (h Hunk) OldRange() (int, int) {
+	if h.OldLines == 0 {
+		return h.OldStart, h.OldStart
+	}
+	return h.OldStart, h.OldStart + h.OldLines - 1
+}
+
+// splitHunk splits a hunk into pieces of at most maxLines lines, each with its own
+// recomputed header so line numbers stay correct.
+func splitHunk(h Hunk, maxLines int) []Hunk {
+	if maxLines <= 0 || len(h.Lines) <= maxLines {
+		return []Hunk{h}
+	}
+	var parts []Hunk
+	for start := 0; start < len(h.Lines); {
+		end := start + maxLines
+		if end > len(h.Lines) {
+			end = len(h.Lines)
+		}
+		// Keep a "\ No newline" marker with the line it annotates.
+		if end < len(h.Lines) && h.Lines[end].Kind == '\\' {
+			end++
+		}
+		parts = append(parts, subHunk(h, start, end))
+		start = end
+	}
+	return parts
+}
+
+// subHunk returns h.Lines[start:end] as a hunk with a recomputed header. An empty
+// side is anchored at the line before the piece, as unified diff does.
+func subHunk(h Hunk, start, end int) Hunk {
+	part := Hunk{Section: h.Section, Lines: h.Lines[start:end]}
+	oldPrev, newPrev := h.OldStart, h.NewStart
+	if h.OldLines > 0 {
+		oldPrev--
+	}
+	if h.NewLines > 0 {
+		newPrev--
+	}
+	for _, l := range h.Lines[:start] {
+		if l.OldLine > 0 {
+			oldPrev = l.OldLine
+		}
+		if l.NewLine > 0 {
+			newPrev = l.NewLine
+		}
+	}
+	for _, l := range part.Lines {
+		if l.OldLine > 0 {
+			if part.OldLines == 0 {
+				part.OldStart = l.OldLine
+			}
+			part.OldLines++
+		}
+		if l.NewLine > 0 {
+			if part.NewLines == 0 {
+				part.NewStart = l.NewLine
+			}
+			part.NewLines++
+		}
+	}
+	if part.OldLines == 0 {
+		part.OldStart = oldPrev
+	}
+	if part.NewLines == 0 {
+		part.NewStart = newPrev
+	}
+	return part
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,3 +10,4 @@ func main() {
+ 	a := 1
+--- removed sql comment
++	b := 2
++	c := 3
+ 	return
+diff --git a/old name.go b/new name.go
+similarity index 90%
+rename from old name.go
+rename to new name.go
+@@ -1,2 +1,2 @@
+-package old
++package new
+ 
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..3333333
+Binary files /dev/null and b/logo.png differ
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+index 4444444..0000000
+--- a/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package gone
+-// bye
+\ No newline at end of file
+`
+
+func TestParseDiff(t *testing.T) {
+	files, err := ParseDiff(sampleDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("expected 5 files, got %d", len(files))
+	}
+
+	main := files[0]
+	if main.Path() != "main.go" || len(main.Hunks) != 1 || len(main.Header) != 4 {
+		t.Fatalf("unexpected main.go diff: %+v", main)
+	}
+	h := main.Hunks[0]
+	if h.OldStart != 10 || h.NewStart != 10 || h.NewLines != 4 || h.Section != "func main() {" || len(h.Lines) != 5 {
+		t.Errorf("unexpected hunk: %+v", h)
+	}
+	if h.Lines[1].Kind != '-' || h.Lines[1].Text != "-- removed sql comment" || h.Lines[1].OldLine != 11 {
+		t.Errorf("removed line starting with -- misparsed: %+v", h.Lines[1])
+	}
+	if h.Lines[3].Kind != '+' || h.Lines[3].NewLine != 12 || h.Lines[4].OldLine != 12 || h.Lines[4].NewLine != 13 {
+		t.Errorf("unexpected line numbers: %+v", h.Lines)
+	}
+
+	rename := files[1]
+	if !rename.IsRename || rename.OldPath != "old name.go" || rename.NewPath != "new name.go" {
+		t.Errorf("unexpected rename: %+v", rename)
+	}
+	if len(rename.Hunks) != 1 || len(rename.Hunks[0].Lines) != 3 {
+		t.Errorf("empty context line not parsed: %+v", rename.Hunks)
+	}
+
+	mode := files[2]
+	if mode.OldMode != "100644" || mode.NewMode != "100755" || len(mode.Hunks) != 0 {
+		t.Errorf("unexpected mode change: %+v", mode)
+	}
+
+	if !files[3].IsBinary || !files[3].IsNew || files[3].Path() != "logo.png" {
+		t.Errorf("unexpected binary file: %+v", files[3])
+	}
+
+	gone := files[4]
+	if !gone.IsDeleted || gone.Path() != "gone.go" || len(gone.Hunks[0].Lines) != 3 || gone.Hunks[0].Lines[2].Kind != '\\' {
+		t.Errorf("unexpected deleted file: %+v", gone)
+	}
+}
+
+func TestChunkDiff_HunkBoundaries(t *testing.T) {
+	chunks := ChunkDiff(sampleDiff, ChunkBudget{Lines: 100})
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks (binary and mode-only skipped), got %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if !strings.HasPrefix(c.Content, "diff --git ") {
+			t.Errorf("chunk for %s does not start with file header:\n%s", c.File, c.Content)
+		}
+	}
+	if chunks[0].File != "main.go" || chunks[0].StartLine != 10 || chunks[0].EndLine != 13 {
+		t.Errorf("unexpected first chunk: %+v", chunks[0])
+	}
+	if chunks[2].File != "gone.go" || chunks[2].StartLine != 1 || chunks[2].EndLine != 2 {
+		t.Errorf("unexpected deleted-file chunk: %+v", chunks[2])
+	}
+}
+
+func TestChunkDiff_SplitsLargeHunk(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("diff --git a/big.go b/big.go\n--- a/big.go\n+++ b/big.go\n@@ -1,10 +1,10 @@\n")
+	for i := 0; i < 10; i++ {
+		b.WriteString("-old\n+new\n")
+	}
+	chunks := ChunkDiff(b.String(), ChunkBudget{Lines: 10})
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d", len(chunks))
+	}
+	for _, c := range chunks {
+		files, err := ParseDiff(c.Content)
+		if err != nil {
+			t.Fatalf("chunk is not a valid diff: %v\n%s", err, c.Content)
+		}
+		if len(files) != 1 || files[0].Path() != "big.go" {
+			t.Fatalf("unexpected chunk files: %+v", files)
+		}
+	}
+	if chunks[1].StartLine != 4 || chunks[1].EndLine != 6 {
+		t.Errorf("unexpected second chunk range: %d-%d", chunks[1].StartLine, chunks[1].EndLine)
+	}
+}
+
+func TestChunkDiff_FallbackHasNoLineNumbers(t *testing.T) {
+	diff := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -10,2 +10,2 @@\n-a\n+b\n?? not a diff line\n"
+	chunks := ChunkDiff(diff, ChunkBudget{Lines: 100})
+	if len(chunks) != 1 || chunks[0].File != "x.go" {
+		t.Fatalf("unexpected fallback chunks: %+v", chunks)
+	}
+	c := chunks[0]
+	if c.StartLine != 0 || c.EndLine != 0 {
+		t.Errorf("fallback chunk should carry no line numbers, got %d-%d", c.StartLine, c.EndLine)
+	}
+	req := reviewRequest(LanguageConfig{Name: "go"}, c, 100, false)
+	if strings.Contains(req.User, "1| diff --git") || strings.Contains(req.User, "real line number") {
+		t.Errorf("fallback chunk should be sent without a line gutter:\n%s", req.User)
+	}
+	findings := c.MapFindings([]Finding{{File: "x.go", StartLine: 1, EndLine: 7}})
+	if findings[0].StartLine != 0 || findings[0].EndLine != 0 {
+		t.Errorf("findings of a fallback chunk should not keep line numbers: %+v", findings[0])
+	}
+}
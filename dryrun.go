@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// reviewBatch is the chunks of one language that a run reviews together.
+type reviewBatch struct {
+	Lang   string
+	Files  int
+	Chunks []Chunk
+}
+
+// DryRun renders every request a run over batches would send without contacting
+// the provider. It prints chunk counts and estimated prompt tokens per file and the
+// estimated cost of the run, and writes each prompt to promptDir when it is set.
+// Completion tokens are counted at the full reply budget, so they are an upper bound.
+func DryRun(cfg *Config, batches []reviewBatch, structured bool, promptDir string, out io.Writer) (Usage, error) {
+	limits := cfg.ModelLimits()
+	if promptDir != "" {
+		if err := os.MkdirAll(promptDir, 0o755); err != nil {
+			return Usage{}, err
+		}
+	}
+	total := Usage{Estimated: true}
+	var files, chunks, requests int
+	for _, b := range batches {
+		langCfg, _ := cfg.Language(b.Lang)
+		fmt.Fprintf(out, "\n[DRY RUN] %s: %d chunk(s)\n", b.Lang, len(b.Chunks))
+		perFile := map[string]*Usage{}
+		counts := map[string]int{}
+		var order []string
+		for i, chunk := range b.Chunks {
+			reqs := []struct {
+				kind string
+				req  ChatRequest
+			}{
+				{"review", reviewRequest(langCfg, chunk, limits.MaxOutputTokens, structured)},
+				{"tests", testRequest(langCfg, chunk.Text(), limits.MaxOutputTokens)},
+			}
+			u := perFile[chunk.File]
+			if u == nil {
+				u = &Usage{}
+				perFile[chunk.File] = u
+				order = append(order, chunk.File)
+			}
+			counts[chunk.File]++
+			for _, r := range reqs {
+				u.Add(Usage{
+					PromptTokens:     limits.EstimateTokens(r.req.System) + limits.EstimateTokens(r.req.User),
+					CompletionTokens: r.req.MaxTokens,
+				})
+				requests++
+				if promptDir == "" {
+					continue
+				}
+				name := filepath.Join(promptDir, fmt.Sprintf("%s-%04d-%s.txt", b.Lang, i+1, r.kind))
+				if err := os.WriteFile(name, []byte(renderPrompt(chunk, r.req)), 0o644); err != nil {
+					return total, err
+				}
+			}
+		}
+		for _, f := range order {
+			fmt.Fprintf(out, "  %s: %d chunk(s), ~%d prompt tokens\n", f, counts[f], perFile[f].PromptTokens)
+			total.Add(*perFile[f])
+		}
+		files += len(order)
+		chunks += len(b.Chunks)
+	}
+	fmt.Fprintf(out, "\n[DRY RUN] %d file(s), %d chunk(s), %d request(s): ~%d prompt tokens, up to %d completion tokens\n",
+		files, chunks, requests, total.PromptTokens, total.CompletionTokens)
+	if price, ok := cfg.Price(); ok {
+		fmt.Fprintf(out, "[DRY RUN] Estimated cost: ~$%.4f for prompts, up to ~$%.4f with full replies\n",
+			price.Cost(Usage{PromptTokens: total.PromptTokens}), price.Cost(total))
+	} else {
+		fmt.Fprintf(out, "[DRY RUN] No [prices.%q] entry; cost not estimated\n", cfg.modelName())
+	}
+	if promptDir != "" {
+		fmt.Fprintf(out, "[DRY RUN] Wrote %d prompt(s) to %s\n", requests, promptDir)
+	}
+	return total, nil
+}
+
+// renderPrompt formats req for inspection: where the chunk comes from, the reply
+// budget, then the system and user messages exactly as sent.
+func renderPrompt(chunk Chunk, req ChatRequest) string {
+	header := fmt.Sprintf("# %s", chunk.File)
+	if chunk.StartLine > 0 {
+		header += fmt.Sprintf(" lines %d-%d", chunk.StartLine, chunk.EndLine)
+	}
+	header += fmt.Sprintf("\n# max_tokens: %d", req.MaxTokens)
+	if req.Schema != nil {
+		header += "\n# response: findings JSON schema"
+	}
+	return fmt.Sprintf("%s\n\n=== system ===\n%s\n\n=== user ===\n%s\n", header, req.System, req.User)
+}
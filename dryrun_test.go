@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	cfg := testLoopConfig()
+	cfg.LLMModel = "m"
+	cfg.Models = map[string]ModelLimits{"m": {MaxOutputTokens: 1000}}
+	cfg.Prices = map[string]Price{"m": {Input: 1, Output: 2}}
+	batches := []reviewBatch{{Lang: "go", Chunks: []Chunk{
+		{File: "a.go", StartLine: 1, EndLine: 2, Content: "package a\nfunc A() {}"},
+		{File: "a.go", StartLine: 3, EndLine: 3, Content: "func B() {}"},
+		{File: "b.go", StartLine: 1, EndLine: 1, Content: "package b"},
+	}}}
+	dir := filepath.Join(t.TempDir(), "prompts")
+	var out strings.Builder
+	u, err := DryRun(cfg, batches, true, dir, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.CompletionTokens != 6000 || u.PromptTokens == 0 || !u.Estimated {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+	for _, want := range []string{"a.go: 2 chunk(s)", "b.go: 1 chunk(s)", "3 chunk(s), 6 request(s)", "Estimated cost", "Wrote 6 prompt(s)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "go-0002-review.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := string(b)
+	for _, want := range []string{"# a.go lines 3-3", "=== system ===\nreview" + findingsInstruction, "    3| func B() {}"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go-0003-tests.txt")); err != nil {
+		t.Error(err)
+	}
+}
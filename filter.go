@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Reasons FileFilter.Skip gives for leaving a file out of a review.
+const (
+	skipIgnored     = "ignored"
+	skipExcluded    = "excluded"
+	skipNotIncluded = "not included"
+	skipGenerated   = "generated"
+)
+
+// ignoreFiles are read in every directory, in this order, so .reviewerignore can
+// re-include what .gitignore leaves out with "!pattern".
+var ignoreFiles = []string{".gitignore", ".reviewerignore"}
+
+// generatedRe matches the standard header of generated files
+// (https://golang.org/s/generatedcode), in any common comment syntax.
+var generatedRe = regexp.MustCompile(`(?m)^\s*(?://|#|/\*|\*|--)\s*Code generated .* DO NOT EDIT\.`)
+
+// generatedScanBytes is how much of a file is searched for the generated header.
+const generatedScanBytes = 4096
+
+// globRule is one gitignore-style pattern, relative to base.
+type globRule struct {
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// FileFilter decides which files under root are reviewed. It applies the
+// .gitignore and .reviewerignore files of root and its subdirectories, the exclude
+// and include globs of the config and command line, and skips generated files.
+// Globs use gitignore syntax relative to root: "vendor/", "*.pb.go", "cmd/**/main.go".
+type FileFilter struct {
+	root    string
+	include []globRule
+	exclude []globRule
+	ignore  []globRule
+	loaded  map[string]bool
+}
+
+// NewFileFilter returns a filter for the files under root.
+func NewFileFilter(root string, include, exclude []string) (*FileFilter, error) {
+	f := &FileFilter{root: filepath.Clean(root), loaded: map[string]bool{}}
+	for _, p := range include {
+		r, err := compileGlob(f.root, p)
+		if err != nil {
+			return nil, fmt.Errorf("include pattern %q: %w", p, err)
+		}
+		f.include = append(f.include, r)
+	}
+	for _, p := range exclude {
+		r, err := compileGlob(f.root, p)
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", p, err)
+		}
+		f.exclude = append(f.exclude, r)
+	}
+	return f, nil
+}
+
+// SkipDir reports whether the walk should not descend into dir.
+func (f *FileFilter) SkipDir(dir string) bool {
+	if filepath.Clean(dir) == f.root {
+		return false
+	}
+	if filepath.Base(dir) == ".git" {
+		return true
+	}
+	return f.ignored(dir, true) || matchAny(f.exclude, dir, true)
+}
+
+// Skip returns why path should not be reviewed, or "" to review it.
+func (f *FileFilter) Skip(path string) string {
+	if _, ok := relPath(f.root, path); !ok {
+		// Paths outside root are not covered by its ignore files or globs.
+		return ""
+	}
+	dirs := f.ancestors(path)
+	for _, d := range dirs {
+		if f.SkipDir(d) {
+			if matchAny(f.exclude, d, true) {
+				return skipExcluded
+			}
+			return skipIgnored
+		}
+	}
+	if f.ignored(path, false) {
+		return skipIgnored
+	}
+	if matchAny(f.exclude, path, false) {
+		return skipExcluded
+	}
+	if len(f.include) > 0 && !matchAny(f.include, path, false) {
+		included := false
+		for _, d := range dirs {
+			if matchAny(f.include, d, true) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return skipNotIncluded
+		}
+	}
+	if isGenerated(path) {
+		return skipGenerated
+	}
+	return ""
+}
+
+// ancestors returns the directories between root (exclusive) and path, outermost first.
+func (f *FileFilter) ancestors(path string) []string {
+	var dirs []string
+	for d := filepath.Dir(filepath.Clean(path)); d != f.root && d != "." && d != string(filepath.Separator); d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+	}
+	return dirs
+}
+
+// ignored applies the ignore files from root down to path's directory; the last
+// matching pattern wins, as in git.
+func (f *FileFilter) ignored(path string, isDir bool) bool {
+	f.load(f.root)
+	for _, d := range f.ancestors(path) {
+		f.load(d)
+	}
+	ignored := false
+	for _, r := range f.ignore {
+		if r.match(path, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// load reads the ignore files of dir once.
+func (f *FileFilter) load(dir string) {
+	if f.loaded[dir] {
+		return
+	}
+	f.loaded[dir] = true
+	for _, name := range ignoreFiles {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(file)
+		for sc.Scan() {
+			line := strings.TrimRight(sc.Text(), " \t\r")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			r, err := compileGlob(dir, line)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[!] Ignoring pattern %q in %s: %v\n", line, filepath.Join(dir, name), err)
+				continue
+			}
+			f.ignore = append(f.ignore, r)
+		}
+		_ = file.Close()
+	}
+}
+
+// relPath returns path relative to base with forward slashes, or false if path is
+// not under base.
+func relPath(base, path string) (string, bool) {
+	rel, err := filepath.Rel(base, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (r globRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, ok := relPath(r.base, path)
+	return ok && r.re.MatchString(rel)
+}
+
+func matchAny(rules []globRule, path string, isDir bool) bool {
+	for _, r := range rules {
+		if r.match(path, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlob compiles a gitignore-style pattern. A pattern with a slash other than
+// a trailing one is anchored to base; otherwise it matches at any depth. A trailing
+// slash matches directories only, "**" spans directories and a leading "!" negates.
+func compileGlob(base, pattern string) (globRule, error) {
+	r := globRule{base: filepath.Clean(base)}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				b.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				break
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return r, err
+	}
+	r.re = re
+	return r, nil
+}
+
+// isGenerated reports whether the file at path starts with a
+// "Code generated ... DO NOT EDIT." header.
+func isGenerated(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = file.Close() }()
+	buf := make([]byte, generatedScanBytes)
+	n, _ := io.ReadFull(file, buf)
+	return generatedRe.Match(buf[:n])
+}
+
+// skipSummary formats per-reason skip counts, e.g. "12 ignored, 2 generated".
+func skipSummary(counts map[string]int) string {
+	var parts []string
+	for _, reason := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+	}
+	return strings.Join(parts, ", ")
+}
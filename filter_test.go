@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		isDir, want   bool
+	}{
+		{"*.pb.go", "api/v1/service.pb.go", false, true},
+		{"*.pb.go", "api/v1/service.go", false, false},
+		{"vendor/", "vendor", true, true},
+		{"vendor/", "third_party/vendor", true, true},
+		{"vendor/", "vendor", false, false},
+		{"/main.go", "main.go", false, true},
+		{"/main.go", "cmd/main.go", false, false},
+		{"cmd/*.go", "cmd/main.go", false, true},
+		{"cmd/*.go", "cmd/tool/main.go", false, false},
+		{"cmd/**/main.go", "cmd/tool/main.go", false, true},
+		{"cmd/**/main.go", "cmd/main.go", false, true},
+		{"**/testdata", "a/b/testdata", true, true},
+		{"docs/**", "docs/a/b.go", false, true},
+		{"file?.go", "file1.go", false, true},
+		{"file[!0-9].go", "file1.go", false, false},
+		{"file[!0-9].go", "filex.go", false, true},
+	}
+	root := t.TempDir()
+	for _, tt := range tests {
+		r, err := compileGlob(root, tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := r.match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+			t.Errorf("%q on %q (dir %v): got %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestFileFilter_Skip(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":               "build/\n*.log.go\n!keep.log.go\nsecret.go\n",
+		".reviewerignore":          "# reviewed although git ignores it\n!secret.go\nfixtures/\n",
+		"main.go":                  "package main\n",
+		"keep.log.go":              "package main\n",
+		"debug.log.go":             "package main\n",
+		"secret.go":                "package main\n",
+		"build/out.go":             "package main\n",
+		"pkg/fixtures/data.go":     "package pkg\n",
+		"pkg/api/api.pb.go":        "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n",
+		"pkg/api/api.go":           "package api\n",
+		"pkg/sub/.gitignore":       "local.go\n",
+		"pkg/sub/local.go":         "package sub\n",
+		"pkg/sub/sub.go":           "package sub\n",
+		"scripts/gen.py":           "# Code generated by tool. DO NOT EDIT.\nprint(1)\n",
+		"vendor/lib/lib.go":        "package lib\n",
+		"docs/not_generated.go":    "package docs\n\n// Mentions Code generated ... DO NOT EDIT. in prose.\n",
+		"internal/lib/lib_test.go": "package lib\n",
+		"internal/lib/lib.go":      "package lib\n",
+	})
+	f, err := NewFileFilter(root, nil, []string{"vendor/", "*_test.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"main.go":                  "",
+		"keep.log.go":              "",
+		"debug.log.go":             skipIgnored,
+		"secret.go":                "",
+		"build/out.go":             skipIgnored,
+		"pkg/fixtures/data.go":     skipIgnored,
+		"pkg/api/api.pb.go":        skipGenerated,
+		"pkg/api/api.go":           "",
+		"pkg/sub/local.go":         skipIgnored,
+		"pkg/sub/sub.go":           "",
+		"scripts/gen.py":           skipGenerated,
+		"vendor/lib/lib.go":        skipExcluded,
+		"docs/not_generated.go":    "",
+		"internal/lib/lib_test.go": skipExcluded,
+		"internal/lib/lib.go":      "",
+	}
+	for name, reason := range want {
+		if got := f.Skip(filepath.Join(root, filepath.FromSlash(name))); got != reason {
+			t.Errorf("%s: got %q, want %q", name, got, reason)
+		}
+	}
+	if !f.SkipDir(filepath.Join(root, ".git")) || !f.SkipDir(filepath.Join(root, "build")) {
+		t.Error(".git and ignored directories should not be walked")
+	}
+	if f.SkipDir(root) {
+		t.Error("the root should always be walked")
+	}
+}
+
+func TestFileFilter_Include(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"main.go":          "package main\n",
+		"cmd/tool/main.go": "package main\n",
+		"internal/a.go":    "package internal\n",
+		"internal/a.php":   "<?php\n",
+	})
+	f, err := NewFileFilter(root, []string{"cmd/", "internal/*.go"}, []string{"cmd/tool/main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"main.go":          skipNotIncluded,
+		"cmd/tool/main.go": skipExcluded,
+		"internal/a.go":    "",
+		"internal/a.php":   skipNotIncluded,
+	}
+	for name, reason := range want {
+		if got := f.Skip(filepath.Join(root, filepath.FromSlash(name))); got != reason {
+			t.Errorf("%s: got %q, want %q", name, got, reason)
+		}
+	}
+}
+
+func TestCollectBatches_ReviewProjectFilters(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":        "tmp/\n",
+		"main.go":           "package main\n",
+		"tmp/scratch.go":    "package tmp\n",
+		"vendor/lib/lib.go": "package lib\n",
+		"gen.go":            "// Code generated by stringer. DO NOT EDIT.\n\npackage main\n",
+		".git/hooks/x.go":   "package hooks\n",
+	})
+	cfg := &Config{
+		Languages: map[string]LanguageConfig{"go": {Extensions: []string{".go"}}},
+		Exclude:   []string{"vendor/"},
+	}
+	batches, err := collectBatches(cfg, "review-project", root, "", "", ChunkBudget{Lines: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, b := range batches {
+		for _, c := range b.Chunks {
+			files = append(files, c.File)
+		}
+	}
+	if len(files) != 1 || files[0] != filepath.Join(root, "main.go") {
+		t.Errorf("only main.go should be reviewed, got %v", files)
+	}
+}
+
+func TestSkipSummary(t *testing.T) {
+	got := skipSummary(map[string]int{skipIgnored: 12, skipGenerated: 2})
+	if got != "2 generated, 12 ignored" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity levels, ordered from most to least severe.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+)
+
+// Finding categories.
+const (
+	CategoryCorrectness = "correctness"
+	CategorySecurity    = "security"
+	CategoryPerformance = "performance"
+	CategoryTesting     = "testing"
+)
+
+var severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+var categories = []string{CategoryCorrectness, CategorySecurity, CategoryPerformance, CategoryTesting}
+
+// Finding is a single issue reported by the reviewer.
+type Finding struct {
+	File         string `json:"file"`
+	StartLine    int    `json:"start_line"`
+	EndLine      int    `json:"end_line"`
+	Severity     string `json:"severity"`
+	Category     string `json:"category"`
+	Message      string `json:"message"`
+	SuggestedFix string `json:"suggested_fix,omitempty"`
+	// OutOfRange is set when the cited lines are not part of the reviewed chunk.
+	OutOfRange bool `json:"out_of_range,omitempty"`
+}
+
+// findingsSchema is the JSON schema of the structured review reply.
+var findingsSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "findings": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "file": {"type": "string"},
+          "start_line": {"type": "integer"},
+          "end_line": {"type": "integer"},
+          "severity": {"type": "string", "enum": ["critical", "high", "medium", "low", "info"]},
+          "category": {"type": "string", "enum": ["correctness", "security", "performance", "testing"]},
+          "message": {"type": "string"},
+          "suggested_fix": {"type": "string"}
+        },
+        "required": ["file", "start_line", "end_line", "severity", "category", "message", "suggested_fix"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["findings"],
+  "additionalProperties": false
+}`)
+
+// findingsInstruction is appended to the review prompt when structured output is requested.
+const findingsInstruction = `
+
+Respond ONLY with a JSON object of the form {"findings": [...]}, with no surrounding prose or markdown.
+Each finding must have these fields:
+- "file": path of the file the issue is in
+- "start_line", "end_line": line numbers of the affected code
+- "severity": one of "critical", "high", "medium", "low", "info"
+- "category": one of "correctness", "security", "performance", "testing"
+- "message": a concise description of the issue
+- "suggested_fix": how to fix it (may be empty)
+Return {"findings": []} if there are no issues.`
+
+// ParseFindings extracts findings from a review. It first looks for the structured
+// JSON reply, then falls back to lenient extraction from markdown bullet lists.
+// Findings without a file are attributed to defaultFile.
+func ParseFindings(review, defaultFile string) []Finding {
+	findings, ok := parseFindingsJSON(review)
+	if !ok {
+		findings = parseFindingsMarkdown(review)
+	}
+	for i := range findings {
+		f := &findings[i]
+		if f.File == "" {
+			f.File = defaultFile
+		}
+		if f.EndLine < f.StartLine {
+			f.EndLine = f.StartLine
+		}
+		f.Severity = normalizeSeverity(f.Severity)
+		f.Category = normalizeCategory(f.Category)
+	}
+	return findings
+}
+
+// isJSONReview reports whether the review is a structured JSON reply.
+func isJSONReview(review string) bool {
+	_, ok := parseFindingsJSON(review)
+	return ok
+}
+
+func parseFindingsJSON(review string) ([]Finding, bool) {
+	text := strings.TrimSpace(review)
+	if m := jsonFenceRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	} else if m := leadingFenceRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	var obj struct {
+		Findings []Finding `json:"findings"`
+	}
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &obj.Findings); err == nil {
+			return obj.Findings, true
+		}
+		return nil, false
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &obj); err != nil || obj.Findings == nil {
+		return nil, false
+	}
+	return obj.Findings, true
+}
+
+var (
+	jsonFenceRe    = regexp.MustCompile("(?s)```json\\s*\\n(.*?)```")
+	leadingFenceRe = regexp.MustCompile("(?s)^```\\s*\\n(.*?)```")
+	bulletRe       = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	headingRe      = regexp.MustCompile(`^\s*#{1,6}\s+(.*)$`)
+	severityRe     = regexp.MustCompile(`(?i)\b(critical|high|medium|low)\b`)
+	lineRefRe      = regexp.MustCompile(`([\w./-]+\.\w+):(\d+)(?:-(\d+))?`)
+	bareLineRefRe  = regexp.MustCompile(`(?i)\blines?\s+(\d+)(?:\s*[-–]\s*(\d+))?`)
+)
+
+// parseFindingsMarkdown turns bullet points that mention a severity into findings.
+// The category is taken from the enclosing heading (e.g. "Security Expert").
+func parseFindingsMarkdown(review string) []Finding {
+	var findings []Finding
+	category := CategoryCorrectness
+	for _, line := range strings.Split(review, "\n") {
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			category = categoryFromHeading(m[1], category)
+			continue
+		}
+		m := bulletRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		text := m[1]
+		sev := severityRe.FindStringSubmatch(text)
+		if sev == nil {
+			continue
+		}
+		f := Finding{
+			Severity: strings.ToLower(sev[1]),
+			Category: category,
+			Message:  strings.TrimSpace(strings.NewReplacer("**", "", "`", "").Replace(text)),
+		}
+		if ref := lineRefRe.FindStringSubmatch(text); ref != nil {
+			f.File = ref[1]
+			f.StartLine, _ = strconv.Atoi(ref[2])
+			f.EndLine, _ = strconv.Atoi(ref[3])
+		} else if ref := bareLineRefRe.FindStringSubmatch(text); ref != nil {
+			f.StartLine, _ = strconv.Atoi(ref[1])
+			f.EndLine, _ = strconv.Atoi(ref[2])
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func categoryFromHeading(heading, current string) string {
+	h := strings.ToLower(heading)
+	switch {
+	case strings.Contains(h, "security"):
+		return CategorySecurity
+	case strings.Contains(h, "test"):
+		return CategoryTesting
+	case strings.Contains(h, "performance"), strings.Contains(h, "memory"):
+		return CategoryPerformance
+	case strings.Contains(h, "programming"), strings.Contains(h, "correctness"):
+		return CategoryCorrectness
+	}
+	return current
+}
+
+// severityRank returns the position of s in severities (0 is most severe), or -1.
+func severityRank(s string) int {
+	for i, sev := range severities {
+		if s == sev {
+			return i
+		}
+	}
+	return -1
+}
+
+// severityAtLeast reports whether s is as severe as threshold or more.
+func severityAtLeast(s, threshold string) bool {
+	r := severityRank(s)
+	return r >= 0 && r <= severityRank(threshold)
+}
+
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, sev := range severities {
+		if s == sev {
+			return s
+		}
+	}
+	return SeverityInfo
+}
+
+func normalizeCategory(c string) string {
+	c = strings.ToLower(strings.TrimSpace(c))
+	for _, cat := range categories {
+		if c == cat {
+			return c
+		}
+	}
+	return CategoryCorrectness
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestParseFindings_JSON(t *testing.T) {
+	review := "```json\n{\"findings\":[{\"file\":\"\",\"start_line\":12,\"end_line\":0,\"severity\":\"HIGH\",\"category\":\"security\",\"message\":\"SQL built with string concatenation\",\"suggested_fix\":\"use placeholders\"}]}\n```"
+	findings := ParseFindings(review, "db.go")
+	if len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(findings))
+	}
+	f := findings[0]
+	if f.File != "db.go" || f.StartLine != 12 || f.EndLine != 12 || f.Severity != SeverityHigh || f.Category != CategorySecurity {
+		t.Errorf("unexpected finding: %+v", f)
+	}
+	if !isJSONReview(review) {
+		t.Error("expected review to be detected as JSON")
+	}
+}
+
+func TestParseFindings_EmptyJSON(t *testing.T) {
+	findings := ParseFindings(`{"findings": []}`, "main.go")
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestParseFindings_MarkdownFallback(t *testing.T) {
+	review := `## Programming Expert
+- **High**: nil map write in handler.go:42-45
+- Consider renaming variables for clarity.
+
+## Security Expert
+1. Critical: token logged in plaintext on line 7
+`
+	findings := ParseFindings(review, "handler.go")
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %+v", findings)
+	}
+	if findings[0].Severity != SeverityHigh || findings[0].Category != CategoryCorrectness || findings[0].StartLine != 42 || findings[0].EndLine != 45 {
+		t.Errorf("unexpected first finding: %+v", findings[0])
+	}
+	if findings[1].Severity != SeverityCritical || findings[1].Category != CategorySecurity || findings[1].StartLine != 7 || findings[1].File != "handler.go" {
+		t.Errorf("unexpected second finding: %+v", findings[1])
+	}
+	if isJSONReview(review) {
+		t.Error("markdown review detected as JSON")
+	}
+}
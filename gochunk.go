@@ -0,0 +1,122 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// goUnit is a run of source lines holding one top-level declaration together
+// with the comments and blank lines preceding it. cuts lists lines after which an
+// oversized unit may be split (ends of top-level statements in a func body).
+type goUnit struct {
+	start, end int
+	cuts       []int
+}
+
+// ChunkGoSource splits Go source on top-level declarations, packing whole funcs
+// and types into chunks of at most chunkSize lines. Every chunk carries the
+// package clause and imports as its Prelude. Declarations larger than a chunk are
+// split at statement boundaries, or at line boundaries as a last resort.
+func ChunkGoSource(path string, src []byte, chunkSize int) ([]Chunk, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(src), "\n")
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	preludeEnd := line(file.Name.End())
+	var units []goUnit
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			preludeEnd = line(gd.End())
+			continue
+		}
+		u := goUnit{end: line(decl.End())}
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Body != nil {
+			for _, stmt := range fd.Body.List {
+				u.cuts = append(u.cuts, line(stmt.End()))
+			}
+		}
+		units = append(units, u)
+	}
+	if len(units) == 0 {
+		return []Chunk{{File: path, StartLine: 1, EndLine: len(lines), Content: string(src)}}, nil
+	}
+	// Each unit starts right after the previous one; the last absorbs trailing lines.
+	next := preludeEnd + 1
+	for i := range units {
+		units[i].start = next
+		next = units[i].end + 1
+	}
+	units[len(units)-1].end = len(lines)
+
+	prelude := strings.Join(lines[:preludeEnd], "\n")
+	budget := chunkSize - preludeEnd
+	if budget < chunkSize/4 {
+		budget = chunkSize / 4
+	}
+	if budget < 1 {
+		budget = 1
+	}
+
+	var chunks []Chunk
+	emit := func(start, end int) {
+		c := Chunk{File: path, StartLine: start, EndLine: end, Content: strings.Join(lines[start-1:end], "\n")}
+		if start > preludeEnd+1 {
+			c.Prelude = prelude
+		} else {
+			// The first chunk already follows the prelude directly; include it in place.
+			c.StartLine = 1
+			c.Content = strings.Join(lines[:end], "\n")
+		}
+		chunks = append(chunks, c)
+	}
+	packStart, packEnd := 0, 0
+	for _, u := range units {
+		size := u.end - u.start + 1
+		if packStart != 0 && packEnd-packStart+1+size > budget {
+			emit(packStart, packEnd)
+			packStart = 0
+		}
+		if size > budget {
+			for _, r := range splitUnit(u, budget) {
+				emit(r[0], r[1])
+			}
+			continue
+		}
+		if packStart == 0 {
+			packStart = u.start
+		}
+		packEnd = u.end
+	}
+	if packStart != 0 {
+		emit(packStart, packEnd)
+	}
+	return chunks, nil
+}
+
+// splitUnit cuts an oversized unit into line ranges of at most budget lines,
+// preferring the last statement boundary that fits.
+func splitUnit(u goUnit, budget int) [][2]int {
+	var ranges [][2]int
+	start := u.start
+	for u.end-start+1 > budget {
+		limit := start + budget - 1
+		cut := 0
+		for _, c := range u.cuts {
+			if c >= start && c <= limit {
+				cut = c
+			}
+		}
+		if cut == 0 {
+			cut = limit
+		}
+		ranges = append(ranges, [2]int{start, cut})
+		start = cut + 1
+	}
+	return append(ranges, [2]int{start, u.end})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const goChunkSrc = `package demo
+
+import "fmt"
+
+// A is small.
+func A() {
+	fmt.Println("a")
+}
+
+type T struct {
+	N int
+}
+
+// B is small too.
+func B() int {
+	return 2
+}
+`
+
+func TestChunkGoSource_PacksWholeDecls(t *testing.T) {
+	chunks, err := ChunkGoSource("demo.go", []byte(goChunkSrc), 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	first, second := chunks[0], chunks[1]
+	if first.StartLine != 1 || first.Prelude != "" || !strings.HasPrefix(first.Content, "package demo") {
+		t.Errorf("first chunk should start with the prelude in place: %+v", first)
+	}
+	if !strings.Contains(first.Content, "func A()") || !strings.Contains(first.Content, "type T struct") {
+		t.Errorf("first chunk should hold A and T whole: %q", first.Content)
+	}
+	if second.Prelude != "package demo\n\nimport \"fmt\"" {
+		t.Errorf("later chunk missing prelude: %q", second.Prelude)
+	}
+	if !strings.HasPrefix(second.Content, "\n// B is small too.") || second.StartLine != 13 {
+		t.Errorf("B should start after T with its doc comment: start=%d %q", second.StartLine, second.Content)
+	}
+	if !strings.Contains(second.Annotated(), "    3| import \"fmt\"\n  ...|\n   13| ") {
+		t.Errorf("annotation should number prelude and body lines:\n%s", second.Annotated())
+	}
+	if !second.hasLine(3) || second.hasLine(8) {
+		t.Errorf("hasLine should cover the prelude and body only")
+	}
+}
+
+func TestChunkGoSource_SplitsLargeFuncAtStatements(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("package demo\n\nfunc Big() {\n")
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&b, "\tif x%d {\n\t\ty()\n\t}\n", i)
+	}
+	b.WriteString("}\n")
+	chunks, err := ChunkGoSource("big.go", []byte(b.String()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected the func to be split, got %d chunk(s)", len(chunks))
+	}
+	for _, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c.Content, "\t}") {
+			t.Errorf("chunk %d-%d should end on a statement boundary: %q", c.StartLine, c.EndLine, c.Content)
+		}
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].StartLine != chunks[i-1].EndLine+1 {
+			t.Errorf("chunks should be contiguous: %+v", chunks)
+		}
+	}
+}
+
+func TestGetFileChunks_FallsBackOnParseError(t *testing.T) {
+	if _, err := ChunkGoSource("bad.go", []byte("package demo\nfunc {"), 10); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	chunks := chunkLines("bad.go", []byte("package demo\nfunc {"), 10)
+	if len(chunks) != 1 || chunks[0].EndLine != 2 {
+		t.Errorf("unexpected line chunks: %+v", chunks)
+	}
+}
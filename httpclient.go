@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// newHTTPClient builds the HTTP client shared by providers from the [llm] section:
+// proxy, TLS/mTLS settings and extra headers. A non-empty apiVersion is sent as the
+// api-version query parameter expected by Azure-style OpenAI gateways.
+func newHTTPClient(cfg LLMConfig, apiVersion string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid llm.proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	tlsCfg, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		transport.TLSClientConfig = tlsCfg
+	}
+	var rt http.RoundTripper = transport
+	if len(cfg.Headers) > 0 || apiVersion != "" {
+		headers := make(map[string]string, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			headers[k] = os.ExpandEnv(v)
+		}
+		rt = &headerTransport{base: transport, headers: headers, apiVersion: apiVersion}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && !c.InsecureSkipVerify && c.ServerName == "" {
+		return nil, nil
+	}
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read llm.tls.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load llm.tls client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// headerTransport adds configured headers and the api-version query parameter to every request.
+type headerTransport struct {
+	base       http.RoundTripper
+	headers    map[string]string
+	apiVersion string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if t.apiVersion != "" {
+		q := req.URL.Query()
+		if q.Get("api-version") == "" {
+			q.Set("api-version", t.apiVersion)
+			req.URL.RawQuery = q.Encode()
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// resolveAPIKey returns the key from llm.api_key_env when configured, else fallback.
+func resolveAPIKey(cfg LLMConfig, fallback string) string {
+	if cfg.APIKeyEnv != "" {
+		return os.Getenv(cfg.APIKeyEnv)
+	}
+	return fallback
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHTTPClient_HeadersAndAPIVersion(t *testing.T) {
+	t.Setenv("GATEWAY_TEAM", "reviewers")
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer srv.Close()
+
+	client, err := newHTTPClient(LLMConfig{Headers: map[string]string{"X-Team": "${GATEWAY_TEAM}"}}, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got.Header.Get("X-Team") != "reviewers" {
+		t.Errorf("X-Team header = %q", got.Header.Get("X-Team"))
+	}
+	if got.URL.Query().Get("api-version") != "2024-06-01" {
+		t.Errorf("api-version = %q", got.URL.Query().Get("api-version"))
+	}
+}
+
+func TestNewHTTPClient_MissingCAFile(t *testing.T) {
+	_, err := newHTTPClient(LLMConfig{TLS: TLSConfig{CAFile: "does-not-exist.pem"}}, "")
+	if err == nil {
+		t.Fatal("expected error for missing CA file")
+	}
+}
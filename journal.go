@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Journal is an append-only JSONL checkpoint of a run. The first line describes
+// the run; every chunk adds a line as soon as it is done, so a run that is killed
+// can be resumed with --resume without reviewing finished chunks again. A nil
+// Journal records nothing.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[journalKey]journalRecord
+}
+
+type journalKey struct{ lang, file, hash string }
+
+// journalRecord is one line of the journal: the run header or a chunk.
+type journalRecord struct {
+	Type string   `json:"type"`
+	Run  *RunInfo `json:"run,omitempty"`
+
+	ContentHash string       `json:"content_hash,omitempty"`
+	Status      string       `json:"status,omitempty"`
+	Started     *time.Time   `json:"started,omitempty"`
+	DurationMS  int64        `json:"duration_ms,omitempty"`
+	Result      *ChunkResult `json:"result,omitempty"`
+}
+
+const (
+	journalRun   = "run"
+	journalChunk = "chunk"
+
+	chunkOK     = "ok"
+	chunkFailed = "failed"
+)
+
+// CreateJournal starts a new journal at path, replacing any earlier one.
+func CreateJournal(path string, run RunInfo) (*Journal, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, done: map[journalKey]journalRecord{}}
+	if err := j.write(journalRecord{Type: journalRun, Run: &run}); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// ResumeJournal reads the journal at path and reopens it for appending. It returns
+// the run the journal was started for. A partly written last line, left by a
+// killed process, is ignored.
+func ResumeJournal(path string) (*Journal, RunInfo, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, RunInfo{}, err
+	}
+	j := &Journal{done: map[journalKey]journalRecord{}}
+	var run *RunInfo
+	r := bufio.NewReader(bytes.NewReader(b))
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec journalRecord
+			if jerr := json.Unmarshal(line, &rec); jerr != nil {
+				fmt.Fprintf(os.Stderr, "[!] Ignoring unreadable line %d of journal %s: %v\n", n, path, jerr)
+			} else if rec.Type == journalRun && run == nil {
+				run = rec.Run
+			} else if rec.Type == journalChunk && rec.Result != nil {
+				k := journalKey{rec.Result.Lang, rec.Result.File, rec.ContentHash}
+				if rec.Status == chunkOK {
+					j.done[k] = rec
+				} else {
+					delete(j.done, k)
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	if run == nil {
+		return nil, RunInfo{}, fmt.Errorf("%s is not a review journal: no run header", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, RunInfo{}, err
+	}
+	// Terminate a partial last line so the next record starts on a line of its own.
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		if _, err := f.WriteString("\n"); err != nil {
+			_ = f.Close()
+			return nil, RunInfo{}, err
+		}
+	}
+	j.f = f
+	return j, *run, nil
+}
+
+// Completed returns the journaled result of chunk if it was reviewed successfully
+// with the same content. Its location and findings are moved to where the chunk
+// is now, in case lines were added or removed above it.
+func (j *Journal) Completed(lang string, chunk Chunk) (ChunkResult, bool) {
+	if j == nil {
+		return ChunkResult{}, false
+	}
+	j.mu.Lock()
+	rec, ok := j.done[journalKey{lang, chunk.File, chunkHash(chunk)}]
+	j.mu.Unlock()
+	if !ok {
+		return ChunkResult{}, false
+	}
+	res := *rec.Result
+	if shift := chunk.StartLine - res.StartLine; shift != 0 {
+		res.Findings = append([]Finding(nil), res.Findings...)
+		for i := range res.Findings {
+			if res.Findings[i].StartLine > 0 {
+				res.Findings[i].StartLine += shift
+			}
+			if res.Findings[i].EndLine > 0 {
+				res.Findings[i].EndLine += shift
+			}
+		}
+	}
+	res.StartLine, res.EndLine = chunk.StartLine, chunk.EndLine
+	return res, true
+}
+
+// Record appends the outcome of chunk and flushes it to disk.
+func (j *Journal) Record(chunk Chunk, res ChunkResult, started time.Time, elapsed time.Duration) error {
+	if j == nil {
+		return nil
+	}
+	status := chunkOK
+	if res.Error != "" {
+		status = chunkFailed
+	}
+	var startedAt *time.Time
+	if !started.IsZero() {
+		startedAt = &started
+	}
+	return j.write(journalRecord{
+		Type:        journalChunk,
+		ContentHash: chunkHash(chunk),
+		Status:      status,
+		Started:     startedAt,
+		DurationMS:  elapsed.Milliseconds(),
+		Result:      &res,
+	})
+}
+
+func (j *Journal) write(rec journalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
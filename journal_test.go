@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal_ResumeSkipsCompletedChunks(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	run := RunInfo{Mode: "review-project", Dir: ".", ConfigHash: "abc"}
+	j, err := CreateJournal(path, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []Chunk{
+		{File: "a.go", StartLine: 1, EndLine: 2, Content: "code-0"},
+		{File: "a.go", StartLine: 3, EndLine: 4, Content: "code-1"},
+		{File: "b.go", StartLine: 1, EndLine: 2, Content: "code-2"},
+	}
+	now := time.Now()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(j.Record(chunks[0], ChunkResult{Index: 0, Lang: "go", File: "a.go", StartLine: 1, EndLine: 2, Review: "done-0",
+		Findings: []Finding{{File: "a.go", StartLine: 2, EndLine: 2}}}, now, time.Second))
+	must(j.Record(chunks[1], ChunkResult{Index: 1, Lang: "go", File: "a.go", StartLine: 3, EndLine: 4, Error: "timeout"}, now, time.Second))
+	must(j.Close())
+	// A killed process can leave half a line behind.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	must(err)
+	_, err = f.WriteString(`{"type":"chunk","content_hash":"`)
+	must(err)
+	must(f.Close())
+
+	j, got, err := ResumeJournal(path)
+	must(err)
+	if got != run {
+		t.Errorf("unexpected run: %+v", got)
+	}
+	// Two lines were added above the first chunk since the journaled run.
+	chunks[0].StartLine, chunks[0].EndLine = 3, 4
+	if res, ok := j.Completed("go", chunks[0]); !ok || res.Review != "done-0" || res.StartLine != 3 || res.Findings[0].StartLine != 4 {
+		t.Errorf("completed chunk not restored at its new location: %+v %v", res, ok)
+	}
+	if _, ok := j.Completed("go", chunks[1]); ok {
+		t.Error("failed chunk must be reviewed again")
+	}
+
+	p := &fakeProvider{delay: func(string) time.Duration { return 0 }}
+	l := &LLMClient{provider: p}
+	report := NewReport("review-project", "fake", "fake-model")
+	opts := ReviewOptions{ChunkTimeout: time.Second, MaxRetries: 1, Concurrency: 2, Journal: j}
+	must(l.ReviewAndFixLoop(context.Background(), testLoopConfig(), "go", chunks, opts, report))
+	must(j.Close())
+	if p.calls != 4 {
+		t.Errorf("only the two unfinished chunks should be sent, got %d requests", p.calls)
+	}
+	results := report.Results()
+	if len(results) != 3 || results[0].Review != "done-0" || results[1].Review != "reply for code-1" || results[2].Index != 2 {
+		t.Errorf("report should combine journaled and new results: %+v", results)
+	}
+
+	// The journal now holds every chunk, so resuming again sends nothing.
+	j, _, err = ResumeJournal(path)
+	must(err)
+	for _, c := range chunks {
+		if _, ok := j.Completed("go", c); !ok {
+			t.Errorf("chunk %s:%d not journaled", c.File, c.StartLine)
+		}
+	}
+	must(j.Close())
+}
+
+func TestJournal_RecordsChunksAsTheyFinish(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := CreateJournal(path, RunInfo{Mode: "review-project", Dir: "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+	chunks := []Chunk{
+		{File: "a.go", StartLine: 1, EndLine: 2, Content: "code-0"},
+		{File: "b.go", StartLine: 1, EndLine: 2, Content: "code-1"},
+	}
+	// The first chunk hangs until the run is cancelled; the second finishes at once.
+	p := &fakeProvider{delay: func(user string) time.Duration {
+		if codeNum(user) == 0 {
+			return time.Hour
+		}
+		return 0
+	}}
+	l := &LLMClient{provider: p}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		opts := ReviewOptions{ChunkTimeout: time.Hour, MaxRetries: 1, Concurrency: 2, Journal: j}
+		done <- l.ReviewAndFixLoop(ctx, testLoopConfig(), "go", chunks, opts, NewReport("review-project", "fake", "fake-model"))
+	}()
+	hash := chunkHash(chunks[1])
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), hash) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("finished chunk was not journaled while an earlier chunk was still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Language returns the [languages.<name>] section of the config with its Name set.
+func (c *Config) Language(name string) (LanguageConfig, bool) {
+	lc, ok := c.Languages[name]
+	lc.Name = name
+	return lc, ok
+}
+
+// LanguageNames returns the configured languages in sorted order.
+func (c *Config) LanguageNames() []string {
+	return sortedKeys(c.Languages)
+}
+
+// LanguageFor returns the language whose extensions match path, or "" if none
+// does. The longest matching extension wins, so ".d.ts" can be told from ".ts".
+func (c *Config) LanguageFor(path string) string {
+	best, bestLen := "", 0
+	for _, name := range c.LanguageNames() {
+		for _, ext := range c.Languages[name].Exts() {
+			if len(ext) > bestLen && strings.HasSuffix(path, ext) {
+				best, bestLen = name, len(ext)
+			}
+		}
+	}
+	return best
+}
+
+// DetectLanguage returns the language of the file at path, trying the configured
+// filenames, then extensions, then shebang interpreters. head returns the first
+// line of the file; it is only called when the name is not enough.
+func (c *Config) DetectLanguage(path string, head func() string) string {
+	base := filepath.Base(path)
+	for _, name := range c.LanguageNames() {
+		for _, f := range c.Languages[name].Filenames {
+			if f == base {
+				return name
+			}
+		}
+	}
+	if l := c.LanguageFor(path); l != "" {
+		return l
+	}
+	interp := shebangInterpreter(head())
+	if interp == "" {
+		return ""
+	}
+	unversioned := strings.TrimRight(interp, "0123456789.")
+	for _, name := range c.LanguageNames() {
+		for _, i := range c.Languages[name].Interpreters {
+			if i == interp || i == unversioned {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// shebangInterpreter returns the interpreter named by a "#!" line, looking
+// through env: "#!/usr/bin/env -S python3 -u" gives "python3".
+func shebangInterpreter(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := filepath.Base(fields[0])
+	if interp != "env" {
+		return interp
+	}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+			return filepath.Base(f)
+		}
+	}
+	return ""
+}
+
+// fileHead returns the first line of the file at path, or "" if it cannot be read.
+func fileHead(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	buf := make([]byte, 256)
+	n, _ := io.ReadFull(f, buf)
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+	return strings.TrimRight(line, "\r")
+}
+
+// Exts returns the file extensions of the language: extensions, plus the older
+// single extension setting.
+func (lc LanguageConfig) Exts() []string {
+	exts := lc.Extensions
+	if lc.Extension != "" {
+		exts = append(append([]string(nil), exts...), lc.Extension)
+	}
+	return exts
+}
+
+// FenceTag is the info string of the Markdown code fences around the language's
+// code: fence, or the language name.
+func (lc LanguageConfig) FenceTag() string {
+	if lc.Fence != "" {
+		return lc.Fence
+	}
+	return lc.Name
+}
+
+// TestFileName expands the test_file pattern for block of the tests generated for
+// chunk. {chunk}, {block} and {time} are replaced by the chunk index, block number
+// and a nanosecond timestamp.
+func (lc LanguageConfig) TestFileName(chunk, block int, now time.Time) (string, error) {
+	if lc.TestFile == "" {
+		return "", fmt.Errorf("test writing not configured for language %s: set test_file in [languages.%s]", lc.Name, lc.Name)
+	}
+	name := strings.NewReplacer(
+		"{chunk}", strconv.Itoa(chunk),
+		"{block}", strconv.Itoa(block),
+		"{time}", strconv.FormatInt(now.UnixNano(), 10),
+	).Replace(lc.TestFile)
+	return filepath.Join(lc.TestDir, name), nil
+}
+
+// languageSummary lists the configured languages and their extensions for error
+// messages.
+func (c *Config) languageSummary() string {
+	var parts []string
+	for _, name := range c.LanguageNames() {
+		lc := c.Languages[name]
+		var matches []string
+		matches = append(matches, lc.Exts()...)
+		matches = append(matches, lc.Filenames...)
+		matches = append(matches, lc.Interpreters...)
+		parts = append(parts, fmt.Sprintf("%s (%s)", name, strings.Join(matches, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_LanguageRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	toml := `
+[languages.go]
+extension = ".go"
+
+[languages.typescript]
+extensions = [".ts", ".tsx"]
+fence = "ts"
+test_file = "gen-{chunk}-{block}.test.ts"
+test_dir = "src/__tests__"
+test_command = ["go", "env", "GOROOT"]
+
+[languages.dts]
+extensions = [".d.ts"]
+`
+	if err := os.WriteFile(path, []byte(toml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.LanguageNames(), ","); got != "dts,go,typescript" {
+		t.Errorf("unexpected languages: %s", got)
+	}
+	for path, want := range map[string]string{"main.go": "go", "src/App.tsx": "typescript", "a.ts": "typescript", "types.d.ts": "dts", "README.md": ""} {
+		if got := cfg.LanguageFor(path); got != want {
+			t.Errorf("LanguageFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	ts, ok := cfg.Language("typescript")
+	if !ok || ts.Name != "typescript" || ts.FenceTag() != "ts" {
+		t.Fatalf("unexpected language: %+v", ts)
+	}
+	if req := reviewRequest(ts, Chunk{Content: "let x = 1"}, 100, false); !strings.Contains(req.User, "```ts\n") {
+		t.Errorf("fence tag not used: %q", req.User)
+	}
+	dir := t.TempDir()
+	files, err := ParseAndWriteTests("```ts\ntest('a', () => {})\n```", ts, dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "src", "__tests__", "gen-3-0.test.ts"); len(files) != 1 || files[0] != want {
+		t.Errorf("expected %s, got %v", want, files)
+	}
+	if err := RunTests(ts, dir, io.Discard); err != nil {
+		t.Errorf("test_command should run: %v", err)
+	}
+
+	goLang, _ := cfg.Language("go")
+	if _, err := ParseAndWriteTests("```go\npackage x\n```", goLang, dir, 0); err == nil || !strings.Contains(err.Error(), "test_file") {
+		t.Errorf("expected a missing test_file error, got %v", err)
+	}
+	if err := RunTests(goLang, dir, io.Discard); err == nil || !strings.Contains(err.Error(), "test_command") {
+		t.Errorf("expected a missing test_command error, got %v", err)
+	}
+}
+
+func TestLoadConfig_LanguageWithoutExtensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[languages.rust]\nreview_prompt = \"x\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("a language without extensions should be rejected")
+	}
+}
+
+func TestTestFileName(t *testing.T) {
+	lc := LanguageConfig{Name: "go", TestFile: "llm_generated_test_{chunk}_{block}_{time}.go"}
+	name, err := lc.TestFileName(2, 1, time.Unix(0, 42))
+	if err != nil || name != "llm_generated_test_2_1_42.go" {
+		t.Errorf("unexpected name %q (%v)", name, err)
+	}
+}
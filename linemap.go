@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// gutterNote tells the model how to read the line-number gutter added by Annotated.
+const gutterNote = "Each line is prefixed with its real line number in %s followed by '|'. " +
+	"Removed diff lines have no number. Always cite these line numbers, never positions within this snippet."
+
+// Annotated returns the chunk content with a gutter of real source line numbers:
+// file lines for file chunks, new-file lines for diff chunks (old-file lines when
+// the file was deleted).
+func (c Chunk) Annotated() string {
+	var b strings.Builder
+	if len(c.Hunks) == 0 {
+		if c.Prelude != "" {
+			prelude := strings.Split(c.Prelude, "\n")
+			for i, line := range prelude {
+				fmt.Fprintf(&b, "%5d| %s\n", i+1, line)
+			}
+			if c.StartLine > len(prelude)+1 {
+				b.WriteString("  ...|\n")
+			}
+		}
+		for i, line := range strings.Split(c.Content, "\n") {
+			fmt.Fprintf(&b, "%5d| %s\n", c.StartLine+i, line)
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	for _, h := range c.Header {
+		b.WriteString(h)
+		b.WriteByte('\n')
+	}
+	for _, h := range c.Hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		if h.Section != "" {
+			b.WriteString(" " + h.Section)
+		}
+		b.WriteByte('\n')
+		for _, l := range h.Lines {
+			n := l.NewLine
+			if c.Deleted {
+				n = l.OldLine
+			}
+			if n > 0 && (l.Kind != '-' || c.Deleted) {
+				fmt.Fprintf(&b, "%5d| %c%s\n", n, l.Kind, l.Text)
+			} else {
+				fmt.Fprintf(&b, "     | %c%s\n", l.Kind, l.Text)
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// hasLine reports whether line n is part of what the chunk showed the model. For
+// diff chunks these are the added and context lines of its hunks.
+func (c Chunk) hasLine(n int) bool {
+	if len(c.Hunks) == 0 {
+		if c.Prelude != "" && n >= 1 && n <= strings.Count(c.Prelude, "\n")+1 {
+			return true
+		}
+		return n >= c.StartLine && n <= c.EndLine
+	}
+	for _, h := range c.Hunks {
+		for _, l := range h.Lines {
+			ln := l.NewLine
+			if c.Deleted {
+				ln = l.OldLine
+			}
+			if ln == n && ln > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MapFindings attributes findings to the chunk's file and flags line references
+// that fall outside the lines the chunk covers. Findings naming another file (or
+// a different path with the same base name) are normalized to the chunk path.
+// A chunk without line numbers (a diff that could not be parsed) cannot place
+// findings, so their line references are dropped.
+func (c Chunk) MapFindings(findings []Finding) []Finding {
+	for i := range findings {
+		f := &findings[i]
+		if c.File != "" && (f.File == "" || sameFile(f.File, c.File)) {
+			f.File = c.File
+		}
+		if c.StartLine == 0 && len(c.Hunks) == 0 {
+			f.StartLine, f.EndLine = 0, 0
+		}
+		if f.StartLine == 0 {
+			continue
+		}
+		if f.File != c.File || !c.hasLine(f.StartLine) || !c.hasLine(f.EndLine) {
+			f.OutOfRange = true
+		}
+	}
+	return findings
+}
+
+// sameFile reports whether a path cited by the model refers to path, allowing for
+// a missing directory prefix or a leading "./".
+func sameFile(cited, path string) bool {
+	cited = filepath.ToSlash(filepath.Clean(cited))
+	path = filepath.ToSlash(filepath.Clean(path))
+	return cited == path || strings.HasSuffix(path, "/"+cited)
+}
+
+func chunkFileName(c Chunk) string {
+	if c.File == "" {
+		return "the file"
+	}
+	return c.File
+}
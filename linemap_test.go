@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunk_AnnotatedDiff(t *testing.T) {
+	chunks := ChunkDiff(sampleDiff, ChunkBudget{Lines: 100})
+	out := chunks[0].Annotated()
+	for _, want := range []string{"   10|  \ta := 1", "     | --- removed sql comment", "   11| +\tb := 2", "   13|  \treturn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("annotated diff missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestChunk_AnnotatedFile(t *testing.T) {
+	c := Chunk{File: "main.go", StartLine: 41, EndLine: 42, Content: "a\nb"}
+	if got := c.Annotated(); got != "   41| a\n   42| b" {
+		t.Errorf("unexpected annotation: %q", got)
+	}
+}
+
+func TestChunk_MapFindings(t *testing.T) {
+	c := ChunkDiff(sampleDiff, ChunkBudget{Lines: 100})[0]
+	findings := c.MapFindings([]Finding{
+		{File: "./main.go", StartLine: 11, EndLine: 12},
+		{File: "", StartLine: 40, EndLine: 40},
+		{File: "other.go", StartLine: 11, EndLine: 11},
+		{File: "main.go"},
+	})
+	if findings[0].File != "main.go" || findings[0].OutOfRange {
+		t.Errorf("in-range finding misflagged: %+v", findings[0])
+	}
+	if findings[1].File != "main.go" || !findings[1].OutOfRange {
+		t.Errorf("out-of-range finding not flagged: %+v", findings[1])
+	}
+	if findings[2].File != "other.go" || !findings[2].OutOfRange {
+		t.Errorf("finding in another file not flagged: %+v", findings[2])
+	}
+	if findings[3].OutOfRange {
+		t.Errorf("finding without lines flagged: %+v", findings[3])
+	}
+}
@@ -3,262 +3,212 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
-
-	openai "github.com/sashabaranov/go-openai"
 )
 
+// progressOut receives human-readable progress output. It is switched to stderr
+// when a machine-readable report is written to stdout.
+var progressOut io.Writer = os.Stdout
 
-type FailedChunk struct {
-	Index int    `json:"index"`
-	Error string `json:"error"`
+type LLMClient struct {
+	provider       Provider
+	limits         ModelLimits
+	limiter        *rateLimiter
+	maxConcurrency int
+	stream         io.Writer
+	structured     bool
+	cache          *ReviewCache
 }
 
-type LLMClient struct {
-	provider     string
-	model        string
-	apiKey       string
-	openaiClient *openai.Client
-	httpClient   *http.Client
-	lmstudioURL  string
+// EnableStructuredOutput asks the model for JSON findings instead of free-form markdown.
+func (l *LLMClient) EnableStructuredOutput() {
+	l.structured = true
 }
 
-// HealthCheck checks if the LLM backend is reachable.
-func (l *LLMClient) HealthCheck(ctx context.Context) error {
-	if l.provider == "lmstudio" {
-		req, err := http.NewRequestWithContext(ctx, "GET", strings.Replace(l.lmstudioURL, "/v1/chat/completions", "/v1/models", 1), nil)
-		if err != nil {
-			return err
-		}
-		resp, err := l.httpClient.Do(req)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("lmstudio health check failed, status: %d", resp.StatusCode)
-		}
-		return nil
-	}
-	// For OpenAI, assume always reachable if apiKey is set
-	if l.provider == "openai" && l.apiKey == "" {
-		return fmt.Errorf("OPENAI_API_KEY is not set")
-	}
-	return nil
+// EnableStreaming makes replies print to w as they arrive, for providers that support it.
+func (l *LLMClient) EnableStreaming(w io.Writer) {
+	l.stream = w
 }
 
-// retryWithBackoff retries a function up to maxRetries with exponential backoff.
-func retryWithBackoff(ctx context.Context, maxRetries int, fn func() error) error {
-	var err error
-	backoff := time.Second
-	for i := 0; i < maxRetries; i++ {
-		err = fn()
-		if err == nil {
-			return nil
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(backoff):
-		}
-		backoff *= 2
-	}
-	return err
+// EnableCache serves repeated requests from c instead of the provider.
+func (l *LLMClient) EnableCache(c *ReviewCache) {
+	l.cache = c
 }
 
-func NewLLMClientWithProvider(cfg *Config, apiKey string) *LLMClient {
-	if cfg.LLMProvider == "lmstudio" {
-		return &LLMClient{
-			provider:    "lmstudio",
-			model:       cfg.LLMModel,
-			apiKey:      apiKey,
-			httpClient:  &http.Client{},
-			lmstudioURL: "http://127.0.0.1:1234/v1/chat/completions",
-		}
+// Streaming reports whether replies are streamed to the terminal.
+func (l *LLMClient) Streaming() bool {
+	if l.stream == nil {
+		return false
 	}
-	return &LLMClient{
-		provider:     "openai",
-		model:        cfg.Model,
-		apiKey:       apiKey,
-		openaiClient: openai.NewClient(apiKey),
+	_, ok := l.provider.(StreamingProvider)
+	return ok
+}
+
+// chunkContext bounds a single LLM call. When streaming, timeout is the maximum time
+// between tokens rather than a deadline for the whole reply.
+func (l *LLMClient) chunkContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if l.Streaming() {
+		return withIdleTimeout(ctx, timeout)
 	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (l *LLMClient) ReviewChunk(ctx context.Context, prompt, code, lang string) (string, error) {
-	if l.provider == "openai" {
-		resp, err := l.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-			Model: l.model,
-			Messages: []openai.ChatCompletionMessage{{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: prompt,
-			}, {
-				Role:    openai.ChatMessageRoleUser,
-				Content: fmt.Sprintf("Here is the %s code diff chunk to review:\n\n```%s\n%s\n```", lang, lang, code),
-			}},
-			MaxTokens: 2048,
+func (l *LLMClient) chat(ctx context.Context, req ChatRequest, title string) (ChatResponse, error) {
+	l.warnOverflow(req, strings.TrimSuffix(title, ":"))
+	var resp ChatResponse
+	var err error
+	if !l.Streaming() {
+		resp, err = l.provider.Chat(ctx, req)
+	} else {
+		fmt.Fprintf(l.stream, "\n%s\n", title)
+		resp, err = l.provider.(StreamingProvider).ChatStream(ctx, req, func(token string) {
+			touchIdle(ctx)
+			fmt.Fprint(l.stream, token)
 		})
-		if err != nil {
-			return "", err
-		}
-		if len(resp.Choices) == 0 {
-			return "No response from LLM", nil
+		fmt.Fprintln(l.stream)
+		err = idleCause(ctx, err)
+	}
+	if err == nil && resp.Usage.Total() == 0 {
+		// The backend did not report usage; estimate it so accounting stays complete.
+		resp.Usage = Usage{
+			PromptTokens:     l.limits.EstimateTokens(req.System) + l.limits.EstimateTokens(req.User),
+			CompletionTokens: l.limits.EstimateTokens(resp.Content),
+			Estimated:        true,
 		}
-		return resp.Choices[0].Message.Content, nil
 	}
+	return resp, err
+}
 
-	return l.lmstudioChat(ctx, prompt, code, lang)
+// maxTokens returns the reply budget for review and test generation requests.
+func (l *LLMClient) maxTokens() int {
+	if l.limits.MaxOutputTokens > 0 {
+		return l.limits.MaxOutputTokens
+	}
+	return defaultMaxTokens
 }
 
-func (l *LLMClient) lmstudioChat(ctx context.Context, prompt, code, lang string) (string, error) {
-	var result string
-	var lastErr error
-	err := retryWithBackoff(ctx, 3, func() error {
-		type msg struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		}
-		body := map[string]interface{}{
-			"model": l.model,
-			"messages": []msg{
-				{Role: "system", Content: prompt},
-				{Role: "user", Content: fmt.Sprintf("Here is the %s code diff chunk to review:\n\n```%s\n%s\n```", lang, lang, code)},
-			},
-			"max_tokens": 2048,
-		}
-		b, err := json.Marshal(body)
-		if err != nil {
-			lastErr = err
-			return err
-		}
-		req, err := http.NewRequestWithContext(ctx, "POST", l.lmstudioURL, bytes.NewReader(b))
-		if err != nil {
-			lastErr = err
-			return err
-		}
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := l.httpClient.Do(req)
-		if err != nil {
-			lastErr = err
-			return err
-		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("error closing response body: %v", err)
-			}
-		}()
-		if resp.StatusCode != 200 {
-			lastErr = fmt.Errorf("lmstudio status %d", resp.StatusCode)
-			return lastErr
-		}
-		var respBody struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-			lastErr = err
+// HealthCheck checks if the LLM backend is reachable.
+func (l *LLMClient) HealthCheck(ctx context.Context) error {
+	return l.provider.HealthCheck(ctx)
+}
+
+// Delays between retries: exponential from retryBaseDelay, capped at retryMaxDelay,
+// unless the server asks for a longer wait.
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// retryWithBackoff calls fn up to maxAttempts times while it fails with a retryable
+// error, waiting with jittered exponential backoff or as long as Retry-After asks.
+// fn is always called at least once.
+func retryWithBackoff(ctx context.Context, maxAttempts int, fn func() error) error {
+	maxAttempts = max(maxAttempts, 1)
+	var err error
+	backoff := retryBaseDelay
+	for i := 0; i < maxAttempts; i++ {
+		err = fn()
+		if err == nil || !IsRetryable(err) || ctx.Err() != nil || i == maxAttempts-1 {
 			return err
 		}
-		if len(respBody.Choices) == 0 {
-			lastErr = fmt.Errorf("no response from LLM")
-			return lastErr
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		wait = max(wait, retryAfter(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
 		}
-		result = respBody.Choices[0].Message.Content
-		return nil
-	})
-	if err != nil {
-		return "", lastErr
+		backoff = min(backoff*2, retryMaxDelay)
 	}
-	return result, nil
+	return err
 }
 
-func (l *LLMClient) GenerateUnitTests(ctx context.Context, prompt, code, lang string) (string, error) {
-	if l.provider == "openai" {
-		resp, err := l.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-			Model: l.model,
-			Messages: []openai.ChatCompletionMessage{{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: prompt,
-			}, {
-				Role:    openai.ChatMessageRoleUser,
-				Content: fmt.Sprintf("Generate unit tests for this %s code diff:\n\n```%s\n%s\n```", lang, lang, code),
-			}},
-			MaxTokens: 2048,
-		})
-		if err != nil {
-			return "", err
-		}
-		if len(resp.Choices) == 0 {
-			return "No response from LLM", nil
-		}
-		return resp.Choices[0].Message.Content, nil
+// NewLLMClientWithProvider builds a client for the backend selected by cfg.LLMProvider.
+func NewLLMClientWithProvider(cfg *Config, apiKey string) (*LLMClient, error) {
+	p, err := NewProvider(cfg, apiKey)
+	if err != nil {
+		return nil, err
 	}
-	// LM Studio
-	return l.lmstudioChatTest(ctx, prompt, code, lang)
+	return &LLMClient{
+		provider:       p,
+		limits:         cfg.ModelLimits(),
+		limiter:        newRateLimiter(cfg.LLM.RequestsPerMinute, cfg.LLM.TokensPerMinute),
+		maxConcurrency: cfg.LLM.MaxConcurrency,
+	}, nil
 }
 
-func (l *LLMClient) lmstudioChatTest(ctx context.Context, prompt, code, lang string) (string, error) {
-	type msg struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+// send answers req from the cache when it can. Otherwise it waits for the rate
+// limiter, then sends req with its own timeout (none if 0), so time spent waiting
+// for the limiter does not count against the request, and caches the reply.
+func (l *LLMClient) send(ctx context.Context, req ChatRequest, title string, timeout time.Duration) (ChatResponse, error) {
+	var key string
+	if l.cache != nil {
+		key = cacheKey(l.provider.Name(), l.provider.Model(), req)
+		if e, ok := l.cache.Get(key); ok {
+			return ChatResponse{Content: e.Content, Cached: true}, nil
+		}
 	}
-	body := map[string]interface{}{
-		"model": l.model,
-		"messages": []msg{
-			{Role: "system", Content: prompt},
-			{Role: "user", Content: fmt.Sprintf("Generate unit tests for this %s code diff:\n\n```%s\n%s\n```", lang, lang, code)},
-		},
-		"max_tokens": 2048,
+	cost := l.limits.EstimateTokens(req.System) + l.limits.EstimateTokens(req.User) + req.MaxTokens
+	if err := l.limiter.Wait(ctx, cost); err != nil {
+		return ChatResponse{}, err
 	}
-	b, err := json.Marshal(body)
-	if err != nil {
-		return "", err
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = l.chunkContext(ctx, timeout)
+		defer cancel()
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", l.lmstudioURL, bytes.NewReader(b))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := l.httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("error closing response body: %v", err)
+	resp, err := l.chat(ctx, req, title)
+	if err == nil && key != "" && resp.Content != "" {
+		e := cacheEntry{Provider: l.provider.Name(), Model: l.provider.Model(), Content: resp.Content, Usage: resp.Usage}
+		if err := l.cache.Put(key, e); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] Could not write review cache: %v\n", err)
 		}
-	}()
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("lmstudio status %d", resp.StatusCode)
 	}
-	var respBody struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	return resp, err
+}
+
+// reviewRequest builds the request that reviews chunk. It needs no provider, so
+// --dry-run can render the exact prompts a run would send.
+func reviewRequest(lc LanguageConfig, chunk Chunk, maxTokens int, structured bool) ChatRequest {
+	code := chunk.Content
+	intro := fmt.Sprintf("Here is the %s code diff chunk to review:", lc.Name)
+	if chunk.StartLine > 0 {
+		code = chunk.Annotated()
+		intro += " " + fmt.Sprintf(gutterNote, chunkFileName(chunk))
+	}
+	req := ChatRequest{
+		System:    lc.ReviewPrompt,
+		User:      fmt.Sprintf("%s\n\n```%s\n%s\n```", intro, lc.FenceTag(), code),
+		MaxTokens: maxTokens,
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return "", err
+	if structured {
+		req.System += findingsInstruction
+		req.Schema = findingsSchema
 	}
-	if len(respBody.Choices) == 0 {
-		return "No response from LLM", nil
+	return req
+}
+
+func testRequest(lc LanguageConfig, code string, maxTokens int) ChatRequest {
+	return ChatRequest{
+		System:    lc.TestPrompt,
+		User:      fmt.Sprintf("Generate unit tests for this %s code diff:\n\n```%s\n%s\n```", lc.Name, lc.FenceTag(), code),
+		MaxTokens: maxTokens,
 	}
-	return respBody.Choices[0].Message.Content, nil
 }
 
-func ParseAndWriteTests(testGen, lang, dir string, chunkIdx int) ([]string, error) {
+// ParseAndWriteTests writes each code block of testGen to a test file of lc under dir.
+func ParseAndWriteTests(testGen string, lc LanguageConfig, dir string, chunkIdx int) ([]string, error) {
 	var files []string
 	start := 0
 	blockNum := 0
@@ -274,16 +224,15 @@ func ParseAndWriteTests(testGen, lang, dir string, chunkIdx int) ([]string, erro
 		}
 		codeEnd += codeStart
 		codeBlock := testGen[codeStart:codeEnd]
-		var filename string
-		switch lang {
-		case "go":
-			filename = filepath.Join(dir, fmt.Sprintf("llm_generated_test_%d_%d_%d.go", chunkIdx, blockNum, time.Now().UnixNano()))
-		case "php":
-			filename = filepath.Join(dir, fmt.Sprintf("LLMGeneratedTest_%d_%d_%d.php", chunkIdx, blockNum, time.Now().UnixNano()))
-		default:
-			return files, fmt.Errorf("test writing not supported for language: %s", lang)
+		name, err := lc.TestFileName(chunkIdx, blockNum, time.Now())
+		if err != nil {
+			return files, err
 		}
-		err := os.WriteFile(filename, []byte(codeBlock), 0644)
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return files, err
+		}
+		err = os.WriteFile(filename, []byte(codeBlock), 0644)
 		if err != nil {
 			return files, err
 		}
@@ -303,169 +252,342 @@ func CleanupGeneratedTests(files []string) {
 	}
 }
 
-func RunTests(lang, dir string) error {
-	var cmd *exec.Cmd
-	switch lang {
-	case "go":
-		cmd = exec.Command("go", "test", "./...")
-		cmd.Dir = dir
-	case "php":
-		cmd = exec.Command("phpunit")
-		cmd.Dir = dir
-	default:
-		return fmt.Errorf("test running not supported for language: %s", lang)
-	}
-	cmd.Stdout = os.Stdout
+// RunTests runs the test_command of lc in dir.
+func RunTests(lc LanguageConfig, dir string, out io.Writer) error {
+	if len(lc.TestCommand) == 0 {
+		return fmt.Errorf("test running not configured for language %s: set test_command in [languages.%s]", lc.Name, lc.Name)
+	}
+	cmd := exec.Command(lc.TestCommand[0], lc.TestCommand[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func (l *LLMClient) ReviewAndFixLoop(ctx context.Context, cfg *Config, lang string, chunks []string, writeTests bool, dir string, keepTests bool, chunkTimeout time.Duration, maxRetries int, failedChunksFile string) error {
+// ReviewOptions controls how ReviewAndFixLoop processes chunks.
+type ReviewOptions struct {
+	WriteTests   bool
+	Dir          string
+	KeepTests    bool
+	ChunkTimeout time.Duration
+	MaxRetries   int
+	// Concurrency is the number of chunks reviewed at once. Use LLMClient.Concurrency
+	// to cap it for the provider.
+	Concurrency int
+	// MaxCost stops the run once the report's estimated cost exceeds it (USD, 0 for
+	// no limit). It needs report.Price to be set.
+	MaxCost float64
+	// Journal, when set, records every finished chunk and supplies the results of
+	// chunks a resumed run already reviewed.
+	Journal *Journal
+}
+
+// ErrCostBudgetExceeded is returned by ReviewAndFixLoop when --max-cost stopped the run.
+var ErrCostBudgetExceeded = errors.New("cost budget exceeded")
+
+// chunkOutcome is what a worker reports for one chunk. With more than one worker
+// its progress output is buffered so chunks print in order.
+type chunkOutcome struct {
+	index       int
+	result      ChunkResult
+	timedOut    bool
+	interrupted bool
+	// restored is set for chunks whose result came from the journal.
+	restored    bool
+	started     time.Time
+	elapsed     time.Duration
+	testFiles   []string
+	testsPassed bool
+	out         *bytes.Buffer
+}
+
+// dirLocks serializes test generation and test runs per directory, since a test
+// run picks up every generated file in the directory.
+var dirLocks sync.Map
+
+func lockDir(dir string) func() {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	v, _ := dirLocks.LoadOrStore(dir, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Concurrency caps the requested number of parallel chunk reviews at the
+// provider's limit, or at [llm] max_concurrency when it is set.
+func (l *LLMClient) Concurrency(requested int) int {
+	limit := l.maxConcurrency
+	if limit <= 0 {
+		if cl, ok := l.provider.(ConcurrencyLimiter); ok {
+			limit = cl.MaxConcurrency()
+		}
+	}
+	if requested < 1 {
+		requested = 1
+	}
+	if limit > 0 && requested > limit {
+		return limit
+	}
+	return requested
+}
+
+// ReviewAndFixLoop reviews chunks with opts.Concurrency workers, collecting results
+// into report in chunk order. Cancelling ctx stops dispatching chunks and cancels
+// requests in flight; chunks cut short by it are left out of the report.
+func (l *LLMClient) ReviewAndFixLoop(ctx context.Context, cfg *Config, lang string, chunks []Chunk, opts ReviewOptions, report *Report) error {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Fprintf(os.Stderr, "[!] Panic in review loop: %v\n", r)
 		}
 	}()
-	// Handle SIGINT for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	interrupted := false
+	langCfg, ok := cfg.Language(lang)
+	if !ok {
+		return fmt.Errorf("unsupported language %s: add a [languages.%s] section to the config", lang, lang)
+	}
+	if opts.MaxCost > 0 && report.Cost() > opts.MaxCost {
+		return ErrCostBudgetExceeded
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := min(max(opts.Concurrency, 1), max(len(chunks), 1))
+	if workers > 1 {
+		fmt.Fprintf(progressOut, "[LLM] Reviewing %d chunks with %d workers\n", len(chunks), workers)
+	}
+	jobs := make(chan int)
+	outcomes := make(chan chunkOutcome)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for i := range chunks {
+			// Chunks a resumed run already reviewed skip the workers.
+			var job chan<- int = jobs
+			var restored chan<- chunkOutcome
+			res, ok := opts.Journal.Completed(lang, chunks[i])
+			if ok {
+				res.Index = i
+				job, restored = nil, outcomes
+			}
+			select {
+			case job <- i:
+			case restored <- chunkOutcome{index: i, result: res, restored: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				outcomes <- l.processChunk(ctx, lang, langCfg, chunks, i, opts, workers > 1)
+			}
+		}()
+	}
 	go func() {
-		<-sigChan
-		fmt.Println("\n[!] Interrupted by user (SIGINT). Printing summary...")
-		interrupted = true
+		wg.Wait()
+		close(outcomes)
 	}()
-	var langCfg *LanguageConfig
-	switch lang {
-	case "go":
-		v := cfg.Languages["go"]
-		langCfg = &v
-	case "php":
-		v := cfg.Languages["php"]
-		langCfg = &v
-	default:
-		return fmt.Errorf("unsupported language: %s", lang)
-	}
-	reviewPrompt := langCfg.ReviewPrompt
-	testPrompt := langCfg.TestPrompt
+
 	var (
-		totalTests   int
-		testsPassed  int
-		testsFailed  int
-		writtenFiles []string
+		totalTests    int
+		testsPassed   int
+		testsFailed   int
+		writtenFiles  []string
+		timeoutCount  int
+		overBudget    bool
+		langUsage     Usage
+		cachedCount   int
+		restoredCount int
 	)
-
-	var failedChunks []FailedChunk
-	timeoutCount := 0
-	for i, chunk := range chunks {
-		if interrupted {
-			break
+	collect := func(o chunkOutcome) {
+		if o.out != nil {
+			_, _ = io.Copy(progressOut, o.out)
+		}
+		if o.interrupted {
+			return
+		}
+		report.Add(o.result)
+		if o.restored {
+			restoredCount++
+			return
+		}
+		langUsage.Add(o.result.Usage)
+		if o.result.Cached {
+			cachedCount++
+		}
+		if o.timedOut {
+			timeoutCount++
+			if timeoutCount >= 3 {
+				fmt.Fprintf(os.Stderr, "[!] Warning: %d consecutive chunk timeouts. Check your LLM backend or consider increasing --chunk-timeout.\n", timeoutCount)
+			}
+		} else {
+			timeoutCount = 0
 		}
-		fmt.Printf("\n--- Reviewing chunk %d/%d [%s] ---\n", i+1, len(chunks), lang)
-		fmt.Fprintf(os.Stderr, "[DEBUG] Starting review for chunk %d/%d\n", i+1, len(chunks))
-		retries := 0
-		var review string
-		var err error
-		for retries = 0; retries < maxRetries; retries++ {
-			chunkCtx, cancel := context.WithTimeout(ctx, chunkTimeout)
-			review, err = l.ReviewChunk(chunkCtx, reviewPrompt, chunk, lang)
+		if opts.MaxCost > 0 && !overBudget && report.Cost() > opts.MaxCost {
+			overBudget = true
+			fmt.Fprintf(os.Stderr, "[!] Estimated cost $%.4f exceeds --max-cost $%.2f; stopping the run\n", report.Cost(), opts.MaxCost)
 			cancel()
-			if err == nil {
-				break
-			}
-			fmt.Fprintf(os.Stderr, "[!] Review error in chunk %d (attempt %d/%d): %v\n", i+1, retries+1, maxRetries, err)
-			fmt.Fprintf(os.Stderr, "[DEBUG] Review returned error: %v\n", err)
-			fmt.Fprintf(os.Stderr, "[DEBUG] Review content: %q\n", review)
-			time.Sleep(2 * time.Second)
 		}
-		if err != nil {
-			if strings.Contains(err.Error(), "context deadline exceeded") {
-				if strings.Contains(err.Error(), "context deadline exceeded") {
-					timeoutCount++
-					if timeoutCount >= 3 {
-						fmt.Fprintf(os.Stderr, "[!] Warning: %d consecutive chunk timeouts. Check your LLM backend or consider increasing --chunk-timeout.\n", timeoutCount)
-					}
-				} else {
-					timeoutCount = 0
-				}
-				failedChunks = append(failedChunks, FailedChunk{Index: i, Error: err.Error()})
-				continue
+		writtenFiles = append(writtenFiles, o.testFiles...)
+		totalTests += len(o.testFiles)
+		if len(o.testFiles) > 0 {
+			if o.testsPassed {
+				testsPassed += len(o.testFiles)
 			} else {
-				timeoutCount = 0
+				testsFailed += len(o.testFiles)
 			}
 		}
-		fmt.Fprintf(os.Stderr, "[DEBUG] Review for chunk %d: %q\n", i+1, review)
-		if review == "" {
-			fmt.Fprintf(os.Stderr, "[WARNING] LLM returned an empty review for chunk %d.\n", i+1)
-		}
-
-		retries = 0
-		var testGen string
-		for retries = 0; retries < maxRetries; retries++ {
-			chunkCtx, cancel := context.WithTimeout(ctx, chunkTimeout)
-			testGen, err = l.GenerateUnitTests(chunkCtx, testPrompt, chunk, lang)
-			cancel()
-			if err == nil {
-				break
+	}
+	// Journal each chunk as soon as it finishes, so a crash does not lose results
+	// that are waiting behind a slower chunk, then collect in chunk order; chunks
+	// never dispatched after SIGINT leave gaps.
+	pending := map[int]chunkOutcome{}
+	next := 0
+	for o := range outcomes {
+		if !o.interrupted && !o.restored {
+			if err := opts.Journal.Record(chunks[o.index], o.result, o.started, o.elapsed); err != nil {
+				fmt.Fprintf(os.Stderr, "[!] Could not write journal: %v\n", err)
 			}
-			fmt.Fprintf(os.Stderr, "[!] Test generation error in chunk %d (attempt %d/%d): %v\n", i+1, retries+1, maxRetries, err)
-			time.Sleep(2 * time.Second)
 		}
-		if err != nil {
-			if strings.Contains(err.Error(), "context deadline exceeded") {
-				timeoutCount++
-				if timeoutCount >= 3 {
-					fmt.Fprintf(os.Stderr, "[!] Warning: %d consecutive chunk timeouts. Check your LLM backend or consider increasing --chunk-timeout.\n", timeoutCount)
-				}
-			} else {
-				timeoutCount = 0
+		pending[o.index] = o
+		for ; ; next++ {
+			o, ok := pending[next]
+			if !ok {
+				break
 			}
-			fmt.Fprintf(os.Stderr, "[!] Test generation error in chunk %d: %v\n", i+1, err)
-			continue
+			delete(pending, next)
+			collect(o)
 		}
-		fmt.Println("\nUnit test suggestions/generation:\n", testGen)
-
-		if writeTests {
-			timeoutCount = 0 // Reset on successful chunk
-			files, err := ParseAndWriteTests(testGen, lang, dir, i)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[!] Failed to write tests: %v\n", err)
-			} else {
-				fmt.Printf("[+] Wrote generated tests: %v\n", files)
-				writtenFiles = append(writtenFiles, files...)
-				totalTests += len(files)
-				err = RunTests(lang, dir)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "[!] Test run failed: %v\n", err)
-					testsFailed += len(files)
-				} else {
-					fmt.Println("[+] Tests passed.")
-					testsPassed += len(files)
-				}
-			}
+	}
+	for i := next; i < len(chunks); i++ {
+		if o, ok := pending[i]; ok {
+			collect(o)
 		}
-		fmt.Printf("[Chunk %d] Done.\n", i+1)
 	}
 
 	// Print summary and cleanup after all chunks processed
-	fmt.Printf("\n===== SUMMARY for %s =====\n", lang)
-	if writeTests && !keepTests {
+	fmt.Fprintf(progressOut, "\n===== SUMMARY for %s =====\n", lang)
+	fmt.Fprintf(progressOut, "Tokens: %s\n", formatUsage(langUsage, report.Price))
+	if cachedCount > 0 {
+		fmt.Fprintf(progressOut, "Reviews served from cache: %d\n", cachedCount)
+	}
+	if restoredCount > 0 {
+		fmt.Fprintf(progressOut, "Restored from journal: %d chunk(s)\n", restoredCount)
+	}
+	if opts.WriteTests {
+		fmt.Fprintf(progressOut, "Generated test files: %d (passed: %d, failed: %d)\n", totalTests, testsPassed, testsFailed)
+	}
+	if opts.WriteTests && !opts.KeepTests {
 		CleanupGeneratedTests(writtenFiles)
 		log.Println("[+] Cleaned up generated test files.")
 	}
-	if len(failedChunks) > 0 && failedChunksFile != "" {
-		f, err := os.Create(failedChunksFile)
+	if overBudget {
+		return ErrCostBudgetExceeded
+	}
+	return nil
+}
+
+// processChunk reviews chunk i and, if the review succeeds, generates tests for it
+// and optionally writes and runs them.
+func (l *LLMClient) processChunk(ctx context.Context, lang string, langCfg LanguageConfig, chunks []Chunk, i int, opts ReviewOptions, buffered bool) (o chunkOutcome) {
+	chunk := chunks[i]
+	o = chunkOutcome{index: i, result: ChunkResult{Index: i, Lang: lang, File: chunk.File, StartLine: chunk.StartLine, EndLine: chunk.EndLine}, started: time.Now()}
+	defer func() { o.elapsed = time.Since(o.started) }()
+	out := progressOut
+	if buffered {
+		o.out = &bytes.Buffer{}
+		out = o.out
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "[!] Panic in chunk %d: %v\n", i+1, r)
+			o.result.Error = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	fmt.Fprintf(out, "\n--- Reviewing chunk %d/%d [%s] ---\n", i+1, len(chunks), lang)
+
+	resp, err := l.retryChunk(ctx, opts, i, reviewRequest(langCfg, chunk, l.maxTokens(), l.structured), "Review:")
+	review := resp.Content
+	o.result.Usage.Add(resp.Usage)
+	if err != nil {
+		o.interrupted = ctx.Err() != nil
+		o.timedOut = errors.Is(err, context.DeadlineExceeded)
+		o.result.Error = err.Error()
+		return o
+	}
+	o.result.Cached = resp.Cached
+	if review == "" {
+		fmt.Fprintf(os.Stderr, "[WARNING] LLM returned an empty review for chunk %d.\n", i+1)
+	} else if resp.Cached {
+		fmt.Fprintln(out, "\nReview (cached):\n", review)
+	} else if !l.Streaming() {
+		fmt.Fprintln(out, "\nReview:\n", review)
+	}
+	o.result.Review = review
+	o.result.Findings = chunk.MapFindings(ParseFindings(review, chunk.File))
+
+	if opts.WriteTests {
+		defer lockDir(opts.Dir)()
+	}
+	resp, err = l.retryChunk(ctx, opts, i, testRequest(langCfg, chunk.Text(), l.maxTokens()), "Unit test suggestions/generation:")
+	testGen := resp.Content
+	o.result.Usage.Add(resp.Usage)
+	if err != nil {
+		o.timedOut = errors.Is(err, context.DeadlineExceeded)
+		fmt.Fprintf(os.Stderr, "[!] Test generation error in chunk %d: %v\n", i+1, err)
+		return o
+	}
+	if resp.Cached {
+		fmt.Fprintln(out, "\nUnit test suggestions/generation (cached):\n", testGen)
+	} else if !l.Streaming() {
+		fmt.Fprintln(out, "\nUnit test suggestions/generation:\n", testGen)
+	}
+	o.result.Tests = testGen
+
+	if opts.WriteTests {
+		files, err := ParseAndWriteTests(testGen, langCfg, opts.Dir, i)
 		if err != nil {
-			log.Printf("[!] Could not write failed chunks file %s: %v\n", failedChunksFile, err)
+			fmt.Fprintf(os.Stderr, "[!] Failed to write tests: %v\n", err)
 		} else {
-			if err := json.NewEncoder(f).Encode(failedChunks); err != nil {
-				log.Printf("[!] Failed to encode failed chunks: %v\n", err)
-			}
-			if err := f.Close(); err != nil {
-				log.Printf("[!] Failed to close failed chunks file: %v\n", err)
+			fmt.Fprintf(out, "[+] Wrote generated tests: %v\n", files)
+			o.testFiles = files
+			if err := RunTests(langCfg, opts.Dir, out); err != nil {
+				fmt.Fprintf(os.Stderr, "[!] Test run failed: %v\n", err)
+			} else {
+				fmt.Fprintln(out, "[+] Tests passed.")
+				o.testsPassed = true
 			}
-			log.Printf("[!] Wrote failed chunks to %s. Use --resume-failed to retry only failed chunks.\n", failedChunksFile)
 		}
 	}
-	return nil
+	fmt.Fprintf(out, "[Chunk %d] Done.\n", i+1)
+	return o
+}
+
+// retryChunk sends req for chunk i with a fresh per-attempt timeout, retrying
+// retryable errors up to opts.MaxRetries attempts. A Retry-After on a rate limit
+// pauses every worker, not just this one.
+func (l *LLMClient) retryChunk(ctx context.Context, opts ReviewOptions, i int, req ChatRequest, title string) (ChatResponse, error) {
+	var out ChatResponse
+	attempt := 0
+	err := retryWithBackoff(ctx, opts.MaxRetries, func() error {
+		attempt++
+		var err error
+		out, err = l.send(ctx, req, title, opts.ChunkTimeout)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "[!] %s error in chunk %d (attempt %d/%d): %v\n", strings.TrimSuffix(title, ":"), i+1, attempt, opts.MaxRetries, err)
+		var perr *ProviderError
+		if errors.As(err, &perr) && perr.StatusCode == http.StatusTooManyRequests {
+			l.limiter.Pause(perr.RetryAfter)
+		}
+		return err
+	})
+	return out, err
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers every chat with the chunk code after a delay, tracking how
+// many requests are in flight.
+type fakeProvider struct {
+	delay func(user string) time.Duration
+	limit int
+
+	mu          sync.Mutex
+	calls       int
+	inFlight    int
+	maxInFlight int
+}
+
+func (p *fakeProvider) Name() string                                 { return "fake" }
+func (p *fakeProvider) Model() string                                { return "fake-model" }
+func (p *fakeProvider) HealthCheck(context.Context) error            { return nil }
+func (p *fakeProvider) ListModels(context.Context) ([]string, error) { return nil, nil }
+func (p *fakeProvider) MaxConcurrency() int                          { return p.limit }
+func (p *fakeProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	p.mu.Lock()
+	p.calls++
+	p.inFlight++
+	p.maxInFlight = max(p.maxInFlight, p.inFlight)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.inFlight--
+		p.mu.Unlock()
+	}()
+	select {
+	case <-time.After(p.delay(req.User)):
+	case <-ctx.Done():
+		return ChatResponse{}, ctx.Err()
+	}
+	return ChatResponse{
+		Content: fmt.Sprintf("reply for code-%d", codeNum(req.User)),
+		Usage:   Usage{PromptTokens: 100, CompletionTokens: 10},
+	}, nil
+}
+
+// codeNum extracts N from the "code-N" content of a test chunk.
+func codeNum(user string) int {
+	var n int
+	fmt.Sscanf(user[strings.LastIndex(user, "code-"):], "code-%d", &n)
+	return n
+}
+
+func testLoopConfig() *Config {
+	return &Config{Languages: map[string]LanguageConfig{"go": {ReviewPrompt: "review", TestPrompt: "tests"}}}
+}
+
+func TestReviewAndFixLoop_ConcurrentOrderedResults(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	// Earlier chunks take longer, so they finish out of order.
+	p := &fakeProvider{delay: func(user string) time.Duration {
+		return time.Duration(10-codeNum(user)) * 5 * time.Millisecond
+	}}
+	l := &LLMClient{provider: p}
+	var chunks []Chunk
+	for i := 0; i < 10; i++ {
+		chunks = append(chunks, Chunk{File: "a.go", Content: fmt.Sprintf("code-%d", i)})
+	}
+	report := NewReport("test", "fake", "fake-model")
+	opts := ReviewOptions{ChunkTimeout: time.Second, MaxRetries: 1, Concurrency: 4}
+	if err := l.ReviewAndFixLoop(context.Background(), testLoopConfig(), "go", chunks, opts, report); err != nil {
+		t.Fatal(err)
+	}
+	results := report.Results()
+	if len(results) != len(chunks) {
+		t.Fatalf("expected %d results, got %d", len(chunks), len(results))
+	}
+	for i, r := range results {
+		if r.Index != i || !strings.HasSuffix(r.Review, fmt.Sprintf("code-%d", i)) {
+			t.Errorf("result %d out of order or mismatched: %+v", i, r)
+		}
+	}
+	if p.maxInFlight < 2 || p.maxInFlight > 4 {
+		t.Errorf("expected 2-4 requests in flight, saw %d", p.maxInFlight)
+	}
+}
+
+func TestLLMClient_Concurrency(t *testing.T) {
+	l := &LLMClient{provider: &fakeProvider{limit: 1}}
+	if n := l.Concurrency(8); n != 1 {
+		t.Errorf("provider cap not applied: %d", n)
+	}
+	l.maxConcurrency = 3
+	if n := l.Concurrency(8); n != 3 {
+		t.Errorf("max_concurrency should override provider cap: %d", n)
+	}
+	if n := l.Concurrency(0); n != 1 {
+		t.Errorf("concurrency below 1 should become 1: %d", n)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	base := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = base })
+
+	calls := 0
+	err := retryWithBackoff(context.Background(), 3, func() error {
+		calls++
+		return &ProviderError{Provider: "test", StatusCode: 400, Retryable: false}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("fatal error should not be retried: calls=%d err=%v", calls, err)
+	}
+
+	calls = 0
+	start := time.Now()
+	err = retryWithBackoff(context.Background(), 3, func() error {
+		calls++
+		if calls < 2 {
+			return &ProviderError{Provider: "test", StatusCode: 429, Retryable: true, RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("rate limit should be retried: calls=%d err=%v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Retry-After not honored, retried after %v", elapsed)
+	}
+
+	calls = 0
+	err = retryWithBackoff(context.Background(), 0, func() error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("fn should be called once even with no attempts allowed: calls=%d err=%v", calls, err)
+	}
+}
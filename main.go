@@ -2,21 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
+
+// Exit codes. 2 is left to the flag package for usage errors.
+const (
+	exitOK           = 0
+	exitInfraError   = 1
+	exitFindings     = 3
+	exitChunksFailed = 4
+	exitBudgetStop   = 5
+	exitInterrupted  = 130
+)
+
 func main() {
-	maxRetries := flag.Int("max-retries", 1, "Max retries for failed chunks")
-	failedChunksFile := flag.String("failed-chunks-file", "failed_chunks.json", "File to save/read failed chunk indices")
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCacheCommand(os.Args[2:]))
+	}
+	maxRetries := flag.Int("max-retries", 3, "Max attempts per chunk request; rate limits, timeouts and server errors are retried with backoff")
+	failedChunksFile := flag.String("failed-chunks-file", "failed_chunks.json", "File to save/read the failed chunks of a run for --resume-failed")
 	resumeFailed := flag.Bool("resume-failed", false, "Only process failed chunks from failed-chunks-file")
 	// Add chunk-timeout flag (default 5m)
-	chunkTimeout := flag.Duration("chunk-timeout", 5*time.Minute, "Timeout for each review chunk (e.g. 2m, 30s)")
+	chunkTimeout := flag.Duration("chunk-timeout", 5*time.Minute, "Timeout for each review chunk (e.g. 2m, 30s); with --stream, the maximum time between tokens")
+	concurrency := flag.Int("concurrency", 1, "Number of chunks to review in parallel (capped per provider; see [llm] max_concurrency)")
+	stream := flag.Bool("stream", true, "Stream review and test generation output as it is generated (openai, lmstudio)")
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	configPath := flag.String("config", "config.toml", "Path to config.toml")
 	mode := flag.String("mode", "diff-uncommitted", "Mode: diff-uncommitted, diff-branch, review-project, review-file")
@@ -25,213 +43,521 @@ func main() {
 	base := flag.String("base", "master", "Base branch for diff-branch mode")
 	writeTests := flag.Bool("write-tests", false, "Automatically write and run generated tests")
 	keepTests := flag.Bool("keep-tests", false, "Keep generated test files after run (default: false)")
-	llmProvider := flag.String("llm-provider", "", "LLM provider: openai or lmstudio (overrides config)")
-	llmModel := flag.String("llm-model", "", "LLM model name for LM Studio or OpenAI (overrides config)")
+	llmProvider := flag.String("llm-provider", "", "LLM provider: "+strings.Join(ProviderNames(), ", ")+" (overrides config)")
+	llmModel := flag.String("llm-model", "", "LLM model name for the selected provider (overrides config)")
+	output := flag.String("output", "", "Write the collected review report to this file (default: stdout for json)")
+	failOn := flag.String("fail-on", "", "Exit with code 3 if any finding has this severity or higher: critical, high, medium, low")
+	maxCost := flag.Float64("max-cost", 0, "Stop the run once the estimated cost exceeds this many USD (needs a [prices] entry for the model)")
+	usageFile := flag.String("usage-file", "", "Write token usage and estimated cost per chunk, language and run to this JSON file")
+	format := flag.String("format", "markdown", "Report format: markdown, json (findings array) or sarif")
+	journalFile := flag.String("journal", "review_journal.jsonl", "Append each chunk's result to this JSONL journal as it completes (empty to disable)")
+	resume := flag.String("resume", "", "Resume the run recorded in this journal, skipping chunks it already reviewed")
+	noCache := flag.Bool("no-cache", false, "Send every request to the LLM instead of reusing cached replies for unchanged chunks")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "Directory of the review cache")
+	cacheTTL := flag.Duration("cache-ttl", defaultCacheTTL, "How long cached replies are reused (0 keeps them forever)")
+	var includes, excludes globList
+	flag.Var(&includes, "include", "Only review files matching these globs (gitignore syntax, comma-separated or repeated; added to config include)")
+	flag.Var(&excludes, "exclude", "Skip files matching these globs (gitignore syntax, comma-separated or repeated; added to config exclude)")
+	dryRun := flag.Bool("dry-run", false, "Find and chunk the code, print chunk counts and estimated tokens and cost, then exit without calling the LLM")
+	promptDir := flag.String("prompt-dir", "", "With --dry-run, write every prompt that would be sent to this directory")
 	flag.Parse()
 
+	if *failOn != "" && severityRank(*failOn) < 0 {
+		fmt.Fprintln(os.Stderr, "Unknown --fail-on severity. Use one of: critical, high, medium, low")
+		os.Exit(exitInfraError)
+	}
+	if *maxRetries < 1 {
+		fmt.Fprintln(os.Stderr, "--max-retries must be at least 1")
+		os.Exit(exitInfraError)
+	}
+	if *format != "markdown" && *format != "json" && *format != "sarif" {
+		fmt.Fprintln(os.Stderr, "Unknown format. Use one of: markdown, json, sarif")
+		os.Exit(exitInfraError)
+	}
+	if *format != "markdown" && *output == "" {
+		progressOut = os.Stderr
+	}
+
 	cfg, err := LoadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitInfraError)
 	}
 
-	var chunks []string
-	var lang string
+	if *llmProvider != "" {
+		cfg.LLMProvider = *llmProvider
+	}
+	if *llmModel != "" {
+		cfg.LLMModel = *llmModel
+		cfg.Model = *llmModel
+	}
+	cfg.Include = append(cfg.Include, includes...)
+	cfg.Exclude = append(cfg.Exclude, excludes...)
+	budget := cfg.ChunkBudget()
+
+	if *resumeFailed && *resume != "" {
+		fmt.Fprintln(os.Stderr, "Use either --resume-failed or --resume, not both")
+		os.Exit(exitInfraError)
+	}
+	var journal *Journal
+	journalPath := *journalFile
+	if *resume != "" {
+		var run RunInfo
+		journal, run, err = ResumeJournal(*resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read journal: %v\n", err)
+			os.Exit(exitInfraError)
+		}
+		if run.ConfigHash != cfg.Hash() {
+			fmt.Fprintf(os.Stderr, "[!] Configuration changed since the journaled run; chunks whose boundaries moved will be reviewed again\n")
+		}
+		// Re-collect the code the journaled run reviewed, whatever the flags say now.
+		*mode, *dir, *base, *file = run.Mode, run.Dir, run.Base, run.File
+		journalPath = *resume
+	}
+
+	var batches []reviewBatch
 	if *resumeFailed {
-		// Read failed chunks indices from file
-		f, err := os.Open(*failedChunksFile)
+		m, err := ReadRunManifest(*failedChunksFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to open failed chunks file: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Failed to read failed chunks file: %v\n", err)
+			os.Exit(exitInfraError)
 		}
-		var failedChunks []struct{ Index int }
-		err = json.NewDecoder(f).Decode(&failedChunks)
-		if err := f.Close(); err != nil {
-			log.Printf("error closing file: %v", err)
+		if m.ConfigHash != cfg.Hash() {
+			fmt.Fprintf(os.Stderr, "[!] Configuration changed since the failed run; chunks whose boundaries moved will be skipped\n")
 		}
+		// Re-collect the code the failed run reviewed, whatever the flags say now.
+		*mode, *dir, *base, *file = m.Mode, m.Dir, m.Base, m.File
+		all, err := collectBatches(cfg, *mode, *dir, *file, *base, budget)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to decode failed chunks file: %v\n", err)
-			os.Exit(1)
-		}
-		// For simplicity, assume review-project mode and Go for now
-		lang = "go"
-		// Load all project chunks
-		ext := cfg.Languages[lang].Extension
-		allChunks, _ := GetProjectChunks(*dir, cfg.ChunkSize, []string{ext})
-		for _, fc := range failedChunks {
-			if fc.Index >= 0 && fc.Index < len(allChunks) {
-				chunks = append(chunks, allChunks[fc.Index])
-
-			}
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(exitInfraError)
+		}
+		var stale []FailedChunk
+		batches, stale = m.ResumeBatches(all)
+		for _, f := range stale {
+			fmt.Fprintf(os.Stderr, "[!] Skipping failed chunk %s: its content changed since the failed run\n", f.location())
+		}
+		if len(batches) == 0 {
+			fmt.Fprintln(progressOut, "No failed chunks left to resume.")
+			return
+		}
+		fmt.Fprintf(progressOut, "[+] Resuming %d of %d failed chunk(s) from %s (mode %s)\n", len(m.Failed)-len(stale), len(m.Failed), *failedChunksFile, *mode)
+	} else {
+		batches, err = collectBatches(cfg, *mode, *dir, *file, *base, budget)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(exitInfraError)
+		}
+		if batches == nil {
+			fmt.Fprintln(progressOut, "No changes to review.")
+			return
 		}
-	} // else normal mode logic below
-
-	if *llmProvider != "" {
-		cfg.LLMProvider = *llmProvider
 	}
-	if *llmModel != "" {
-		cfg.LLMModel = *llmModel
+
+	run := RunInfo{Mode: *mode, Dir: *dir, Base: *base, File: *file, ConfigHash: cfg.Hash()}
+
+	fmt.Fprintf(progressOut, "[LLM] Provider: %s | Model: %s\n", cfg.LLMProvider, cfg.modelName())
+	if budget.Tokens > 0 {
+		limits := cfg.ModelLimits()
+		fmt.Fprintf(progressOut, "[LLM] Context window: %d tokens | Reply budget: %d | Chunk budget: ~%d tokens\n", limits.ContextWindow, limits.MaxOutputTokens, budget.Tokens)
 	}
-	if cfg.LLMProvider == "lmstudio" {
-		allowed := map[string]bool{"claude-3.7-sonnet-reasoning-gemma3-12b": true, "google/gemma-3-12b": true, "openchat_3.5": true}
-		if !allowed[cfg.LLMModel] {
-			fmt.Fprintf(os.Stderr, "Invalid lmstudio model: %s\n", cfg.LLMModel)
-			os.Exit(1)
+	// --fail-on gates on findings, so they must come from the findings schema: the
+	// markdown fallback reads any bullet mentioning "high" or "low" as a finding.
+	structured := *format != "markdown" || *failOn != ""
+	if *dryRun {
+		if _, err := DryRun(cfg, batches, structured, *promptDir, progressOut); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] Dry run failed: %v\n", err)
+			os.Exit(exitInfraError)
 		}
+		return
 	}
-	fmt.Printf("[LLM] Provider: %s | Model: %s\n", cfg.LLMProvider, cfg.LLMModel)
 
-	llm := NewLLMClientWithProvider(cfg, apiKey)
-	ctx := context.Background()
+	llm, err := NewLLMClientWithProvider(cfg, apiKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create LLM client: %v\n", err)
+		os.Exit(exitInfraError)
+	}
+	workers := llm.Concurrency(*concurrency)
+	if workers < *concurrency {
+		fmt.Fprintf(progressOut, "[LLM] Concurrency capped at %d for provider %s (set [llm] max_concurrency to change)\n", workers, llm.provider.Name())
+	}
+	// Streamed tokens from parallel requests would interleave, so only stream with one worker.
+	if *stream && workers == 1 {
+		llm.EnableStreaming(progressOut)
+	}
+	if structured {
+		llm.EnableStructuredOutput()
+	}
+	if !*noCache {
+		llm.EnableCache(NewReviewCache(*cacheDir, *cacheTTL))
+	}
+	opts := ReviewOptions{
+		WriteTests:   *writeTests,
+		Dir:          *dir,
+		KeepTests:    *keepTests,
+		ChunkTimeout: *chunkTimeout,
+		MaxRetries:   *maxRetries,
+		Concurrency:  workers,
+		MaxCost:      *maxCost,
+	}
+	report := NewReport(*mode, llm.provider.Name(), llm.provider.Model())
+	report.Root = *dir
+	if price, ok := cfg.Price(); ok {
+		report.Price = &price
+	} else if *maxCost > 0 {
+		fmt.Fprintf(os.Stderr, "--max-cost needs a [prices.%q] entry in %s\n", cfg.modelName(), *configPath)
+		os.Exit(exitInfraError)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
 	if err := llm.HealthCheck(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "[!] LLM backend health check failed: %v\n", err)
-		fmt.Fprintln(os.Stderr, "Please ensure the LLM backend is running and accessible. For lmstudio, check http://127.0.0.1:1234/v1/models in your browser.")
-		os.Exit(1)
-	}
-
-	getLangConfig := func(lang string) *LanguageConfig {
-		switch lang {
-		case "go":
-			v := cfg.Languages["go"]
-			return &v
-		case "php":
-			v := cfg.Languages["php"]
-			return &v
-		default:
-			return nil
+		fmt.Fprintln(os.Stderr, "Please ensure the LLM backend is running and accessible.")
+		os.Exit(exitInfraError)
+	}
+
+	if journal == nil && journalPath != "" {
+		journal, err = CreateJournal(journalPath, run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create journal: %v\n", err)
+			os.Exit(exitInfraError)
+		}
+	}
+	opts.Journal = journal
+
+	var loopErr error
+	for _, b := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		if *mode == "review-project" || len(batches) > 1 {
+			fmt.Fprintf(progressOut, "\n===== Reviewing language: %s (%d files) =====\n", b.Lang, b.Files)
+		}
+		if err := llm.ReviewAndFixLoop(ctx, cfg, b.Lang, b.Chunks, opts, report); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] Review/fix loop failed for %s: %v\n", b.Lang, err)
+			// Keep a real failure over a later --max-cost stop.
+			if loopErr == nil || errors.Is(loopErr, ErrCostBudgetExceeded) {
+				loopErr = err
+			}
+		}
+	}
+	if len(batches) > 1 {
+		report.WriteLanguageSummary(progressOut)
+	}
+	if err := journal.Close(); err != nil {
+		log.Printf("[!] Could not close journal %s: %v\n", journalPath, err)
+	}
+	writeManifest(*failedChunksFile, RunManifest{RunInfo: run, Failed: FailedChunks(report, batches)})
+	writeReport(report, *output, *format)
+	writeUsage(report, *usageFile)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "[!] Run interrupted; the report only covers the chunks reviewed so far")
+		stop()
+		os.Exit(exitInterrupted)
+	}
+	stop()
+	os.Exit(exitCode(report, *failOn, loopErr))
+}
+
+// interruptContext returns the root context of a run. The first SIGINT or SIGTERM
+// cancels it, which stops dispatching chunks and cancels the requests in flight so
+// the partial report and manifest can be written. A second signal exits at once.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+		case <-ctx.Done():
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\n[!] Interrupted; cancelling requests in flight and writing a partial report. Press Ctrl-C again to exit immediately.")
+		cancel()
+		<-sig
+		fmt.Fprintln(os.Stderr, "[!] Interrupted again; exiting without a report")
+		os.Exit(exitInterrupted)
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// writeManifest saves the failed and pending chunks of the run for --resume-failed,
+// or removes a manifest left by an earlier run when every chunk was reviewed.
+func writeManifest(path string, m RunManifest) {
+	if path == "" {
+		return
+	}
+	if len(m.Failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[!] Could not remove stale failed chunks file %s: %v\n", path, err)
 		}
+		return
+	}
+	if err := WriteRunManifest(path, m); err != nil {
+		log.Printf("[!] Could not write failed chunks file %s: %v\n", path, err)
+		return
 	}
+	log.Printf("[!] Wrote %d failed or pending chunk(s) to %s. Use --resume-failed to retry only those chunks.\n", len(m.Failed), path)
+}
 
-	switch *mode {
+// collectBatches finds and chunks the code to review for mode. It returns nil
+// batches when a diff mode finds no changes left to review.
+func collectBatches(cfg *Config, mode, dir, file, base string, budget ChunkBudget) ([]reviewBatch, error) {
+	switch mode {
 	case "diff-uncommitted":
-		diff, err := GetUncommittedDiff(*dir)
+		diff, err := GetUncommittedDiff(dir)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to get uncommitted diff: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to get uncommitted diff: %w", err)
 		}
-		if strings.Contains(diff, getLangConfig("go").Extension) {
-			lang = "go"
-		} else if strings.Contains(diff, getLangConfig("php").Extension) {
-			lang = "php"
-		} else {
-			lang = "go"
-		}
-		chunks = ChunkDiff(diff, cfg.ChunkSize)
-		if lang == "" {
-			fmt.Fprintln(os.Stderr, "Could not detect language from diff. Supported: ", "go", "php")
-			os.Exit(1)
+		if len(diff) == 0 {
+			return nil, nil
 		}
+		return diffBatches(cfg, dir, diff, budget)
 	case "diff-branch":
-		diff, err := GetBranchDiff(*dir, *base)
+		diff, err := GetBranchDiff(dir, base)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to get branch diff: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to get branch diff: %w", err)
 		}
 		if len(diff) == 0 {
-			fmt.Println("No branch diff changes detected.")
-			return
+			return nil, nil
 		}
-		lang = detectLangFromDiff(diff, cfg)
-		if lang == "" {
-			fmt.Fprintln(os.Stderr, "Could not detect language from diff. Supported: ", keys(cfg.Languages))
-			os.Exit(1)
-		}
-		chunks = ChunkDiff(diff, cfg.ChunkSize)
+		return diffBatches(cfg, dir, diff, budget)
 	case "review-project":
-		langFiles := map[string][]string{"go": {}, "php": {}}
-		extByLang := map[string]string{"go": cfg.Languages["go"].Extension, "php": cfg.Languages["php"].Extension}
-		err = filepath.WalkDir(*dir, func(path string, d os.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
+		filter, err := NewFileFilter(dir, cfg.Include, cfg.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		langFiles := map[string][]string{}
+		skipped := map[string]int{}
+		err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
 				return err
 			}
-			for l, ext := range extByLang {
-				if strings.HasSuffix(path, ext) {
-					langFiles[l] = append(langFiles[l], path)
+			if d.IsDir() {
+				if filter.SkipDir(path) {
+					return filepath.SkipDir
 				}
+				return nil
+			}
+			l := cfg.DetectLanguage(path, func() string { return fileHead(path) })
+			if l == "" {
+				return nil
 			}
+			if reason := filter.Skip(path); reason != "" {
+				skipped[reason]++
+				return nil
+			}
+			langFiles[l] = append(langFiles[l], path)
 			return nil
 		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to scan project files: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to scan project files: %w", err)
+		}
+		if len(skipped) > 0 {
+			fmt.Fprintf(progressOut, "[+] Skipped files: %s\n", skipSummary(skipped))
 		}
-		if len(langFiles["go"]) == 0 && len(langFiles["php"]) == 0 {
-			fmt.Fprintln(os.Stderr, "No supported files found in project.")
-			os.Exit(1)
+		if len(langFiles) == 0 {
+			return nil, fmt.Errorf("no supported files found in project; configured: %s", cfg.languageSummary())
 		}
-		for l, files := range langFiles {
+		var batches []reviewBatch
+		for _, l := range cfg.LanguageNames() {
+			files := langFiles[l]
 			if len(files) == 0 {
 				continue
 			}
-			fmt.Printf("\n===== Reviewing language: %s (%d files) =====\n", l, len(files))
-			var langChunks []string
+			b := reviewBatch{Lang: l, Files: len(files)}
 			for _, f := range files {
-				chunks, err := GetFileChunks(f, cfg.ChunkSize)
+				chunks, err := GetFileChunks(f, budget)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "[!] Failed to chunk file %s: %v\n", f, err)
 					continue
 				}
-				langChunks = append(langChunks, chunks...)
+				b.Chunks = append(b.Chunks, chunks...)
 			}
-			if len(langChunks) == 0 {
+			if len(b.Chunks) == 0 {
 				fmt.Fprintf(os.Stderr, "[!] No chunks to review for language %s\n", l)
 				continue
 			}
-			err = llm.ReviewAndFixLoop(ctx, cfg, l, langChunks, *writeTests, *dir, *keepTests, *chunkTimeout, *maxRetries, *failedChunksFile)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[!] Review/fix loop failed for %s: %v\n", l, err)
-			}
+			batches = append(batches, b)
 		}
-		return
+		return batches, nil
 	case "review-file":
-		if *file == "" {
-			fmt.Fprintln(os.Stderr, "--file must be specified for review-file mode")
-			os.Exit(1)
+		if file == "" {
+			return nil, fmt.Errorf("--file must be specified for review-file mode")
 		}
-		chunks, err = GetFileChunks(*file, cfg.ChunkSize)
+		chunks, err := GetFileChunks(file, budget)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to get file chunks: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to get file chunks: %w", err)
 		}
-		lang = detectLangFromFilename(*file, cfg)
+		lang := cfg.DetectLanguage(file, func() string { return fileHead(file) })
 		if lang == "" {
-			fmt.Fprintln(os.Stderr, "Could not detect language from file. Supported: ", keys(cfg.Languages))
-			os.Exit(1)
+			return nil, fmt.Errorf("could not detect language from file; supported: %s", cfg.languageSummary())
 		}
+		return []reviewBatch{{Lang: lang, Files: 1, Chunks: chunks}}, nil
 	default:
-		fmt.Fprintln(os.Stderr, "Unknown mode. Use one of: diff-uncommitted, diff-branch, review-project, review-file")
-		os.Exit(1)
+		return nil, fmt.Errorf("unknown mode; use one of: diff-uncommitted, diff-branch, review-project, review-file")
+	}
+}
+
+// globList is a flag that collects comma-separated globs over repeated uses.
+type globList []string
+
+func (g *globList) String() string { return strings.Join(*g, ",") }
+
+func (g *globList) Set(v string) error {
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			*g = append(*g, p)
+		}
 	}
+	return nil
+}
 
-	err = llm.ReviewAndFixLoop(ctx, cfg, lang, chunks, *writeTests, *dir, *keepTests, *chunkTimeout, *maxRetries, *failedChunksFile)
+// runCacheCommand handles "reviewer cache prune [--all]" and returns the exit code.
+func runCacheCommand(args []string) int {
+	if len(args) == 0 || args[0] != "prune" {
+		fmt.Fprintln(os.Stderr, "Usage: reviewer cache prune [--cache-dir DIR] [--cache-ttl DURATION] [--all]")
+		return exitInfraError
+	}
+	fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	dir := fs.String("cache-dir", defaultCacheDir(), "Directory of the review cache")
+	ttl := fs.Duration("cache-ttl", defaultCacheTTL, "Remove entries older than this")
+	all := fs.Bool("all", false, "Remove every entry, expired or not")
+	_ = fs.Parse(args[1:])
+	n, err := NewReviewCache(*dir, *ttl).Prune(*all)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Review failed: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "[!] Failed to prune cache %s: %v\n", *dir, err)
+		return exitInfraError
+	}
+	fmt.Printf("Removed %d cache entries from %s\n", n, *dir)
+	return exitOK
+}
+
+// exitCode maps the run outcome to a process exit code. Infrastructure errors win,
+// then findings at or above the --fail-on threshold, then a --max-cost stop, then
+// chunks that failed review.
+func exitCode(report *Report, failOn string, loopErr error) int {
+	if loopErr != nil && !errors.Is(loopErr, ErrCostBudgetExceeded) {
+		return exitInfraError
+	}
+	if failOn != "" {
+		if n := report.CountAtLeast(failOn); n > 0 {
+			fmt.Fprintf(os.Stderr, "[!] %d finding(s) at or above severity %q\n", n, failOn)
+			return exitFindings
+		}
+	}
+	if loopErr != nil {
+		fmt.Fprintln(os.Stderr, "[!] Run stopped by --max-cost; the report only covers the chunks reviewed so far")
+		return exitBudgetStop
 	}
+	if n := report.FailedCount(); n > 0 {
+		fmt.Fprintf(os.Stderr, "[!] %d chunk(s) failed to review\n", n)
+		return exitChunksFailed
+	}
+	return exitOK
 }
 
-func detectLangFromDiff(diff string, cfg *Config) string {
-	for l, lcfg := range cfg.Languages {
-		if strings.Contains(diff, lcfg.Extension) {
-			return l
+// writeReport writes the report to path. Without a path, machine-readable formats go
+// to stdout and the Markdown report is skipped since reviews were already printed.
+func writeReport(report *Report, path, format string) {
+	if path == "" {
+		if format != "markdown" {
+			if err := report.Write(os.Stdout, format); err != nil {
+				fmt.Fprintf(os.Stderr, "[!] Failed to write report: %v\n", err)
+			}
 		}
+		return
+	}
+	if err := report.WriteFile(path, format); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] Failed to write report %s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(progressOut, "[+] Wrote review report to %s\n", path)
+}
+
+// writeUsage prints the run's token usage and writes the usage summary to path, if set.
+func writeUsage(report *Report, path string) {
+	fmt.Fprintf(progressOut, "[LLM] Total usage: %s\n", formatUsage(report.Usage(), report.Price))
+	if path == "" {
+		return
+	}
+	if err := report.WriteUsageFile(path); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] Failed to write usage file %s: %v\n", path, err)
 	}
-	return ""
 }
 
-func detectLangFromFilename(filename string, cfg *Config) string {
-	for l, lcfg := range cfg.Languages {
-		if strings.HasSuffix(filename, lcfg.Extension) {
-			return l
+// diffBatches chunks diff by file and groups the chunks by the language of their
+// file, so each file is reviewed with its own language's prompts. Files of no
+// configured language, and files the FileFilter leaves out, are skipped. It returns
+// nil batches when the filter leaves out every changed file.
+func diffBatches(cfg *Config, dir, diff string, budget ChunkBudget) ([]reviewBatch, error) {
+	filter, err := NewFileFilter(dir, cfg.Include, cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	byLang := map[string][]Chunk{}
+	files := map[string]map[string]bool{}
+	skipped := map[string]bool{}
+	filtered := map[string]int{}
+	unmatched := 0
+	for _, c := range ChunkDiff(diff, budget) {
+		if reason := filter.Skip(filepath.Join(dir, c.File)); reason != "" {
+			if !skipped[c.File] {
+				skipped[c.File] = true
+				filtered[reason]++
+			}
+			continue
+		}
+		lang := cfg.DetectLanguage(c.File, func() string { return chunkHead(dir, c) })
+		if lang == "" {
+			if !skipped[c.File] {
+				skipped[c.File] = true
+				unmatched++
+				fmt.Fprintf(os.Stderr, "[!] Skipping %s: no configured language matches it\n", c.File)
+			}
+			continue
+		}
+		byLang[lang] = append(byLang[lang], c)
+		if files[lang] == nil {
+			files[lang] = map[string]bool{}
 		}
+		files[lang][c.File] = true
 	}
-	return ""
+	if len(filtered) > 0 {
+		fmt.Fprintf(progressOut, "[+] Skipped changed files: %s\n", skipSummary(filtered))
+	}
+	if len(byLang) == 0 {
+		if unmatched == 0 {
+			// Everything changed was excluded, ignored or generated.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no changed file matches a configured language; supported: %s", cfg.languageSummary())
+	}
+	var batches []reviewBatch
+	for _, l := range cfg.LanguageNames() {
+		if chunks := byLang[l]; len(chunks) > 0 {
+			batches = append(batches, reviewBatch{Lang: l, Files: len(files[l]), Chunks: chunks})
+		}
+	}
+	return batches, nil
 }
 
-func keys(m map[string]LanguageConfig) []string {
-	var out []string
-	for k := range m {
-		out = append(out, k)
+// chunkHead returns the first line of a diff chunk's file: from the working tree
+// if it is there, else from the diff when the chunk starts at line 1.
+func chunkHead(dir string, c Chunk) string {
+	if head := fileHead(filepath.Join(dir, c.File)); head != "" {
+		return head
 	}
-	return out
+	for _, h := range c.Hunks {
+		for _, l := range h.Lines {
+			if (!c.Deleted && l.NewLine == 1) || (c.Deleted && l.OldLine == 1) {
+				return l.Text
+			}
+		}
+	}
+	return ""
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -28,3 +29,182 @@ func TestCLI_ReviewFile_Help(t *testing.T) {
 	}
 }
 
+func TestExitCode(t *testing.T) {
+	report := NewReport("diff-branch", "openai", "gpt-4o")
+	report.Add(ChunkResult{Index: 0, Lang: "go", Findings: []Finding{{Severity: SeverityMedium, Category: CategoryCorrectness}}})
+	if code := exitCode(report, "", nil); code != exitOK {
+		t.Errorf("no threshold: got %d, want %d", code, exitOK)
+	}
+	if code := exitCode(report, SeverityHigh, nil); code != exitOK {
+		t.Errorf("medium finding with --fail-on=high: got %d, want %d", code, exitOK)
+	}
+	if code := exitCode(report, SeverityMedium, nil); code != exitFindings {
+		t.Errorf("medium finding with --fail-on=medium: got %d, want %d", code, exitFindings)
+	}
+	report.Add(ChunkResult{Index: 1, Lang: "go", Error: "context deadline exceeded"})
+	if code := exitCode(report, SeverityHigh, nil); code != exitChunksFailed {
+		t.Errorf("failed chunk: got %d, want %d", code, exitChunksFailed)
+	}
+	if code := exitCode(report, SeverityHigh, os.ErrNotExist); code != exitInfraError {
+		t.Errorf("loop error: got %d, want %d", code, exitInfraError)
+	}
+	if code := exitCode(report, SeverityHigh, ErrCostBudgetExceeded); code != exitBudgetStop {
+		t.Errorf("--max-cost stop: got %d, want %d", code, exitBudgetStop)
+	}
+	if code := exitCode(report, SeverityMedium, ErrCostBudgetExceeded); code != exitFindings {
+		t.Errorf("findings before a --max-cost stop: got %d, want %d", code, exitFindings)
+	}
+}
+
+func TestDiffBatches_PerFileLanguage(t *testing.T) {
+	cfg := &Config{Languages: map[string]LanguageConfig{
+		"go":     {Extensions: []string{".go"}},
+		"php":    {Extensions: []string{".php"}},
+		"python": {Extensions: []string{".py"}, Interpreters: []string{"python"}},
+		"make":   {Filenames: []string{"Makefile"}},
+	}}
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,2 @@
+ package main
++var x = 1
+diff --git a/web/index.php b/web/index.php
+--- a/web/index.php
++++ b/web/index.php
+@@ -1,1 +1,1 @@
+-<?php echo 1;
++<?php echo 2;
+diff --git a/schema.sql b/schema.sql
+--- a/schema.sql
++++ b/schema.sql
+@@ -1,1 +1,1 @@
+-CREATE TABLE a (id int);
++CREATE TABLE b (id int);
+diff --git a/bin/tool b/bin/tool
+new file mode 100755
+--- /dev/null
++++ b/bin/tool
+@@ -0,0 +1,2 @@
++#!/usr/bin/env python3
++print("hi")
+diff --git a/Makefile b/Makefile
+--- a/Makefile
++++ b/Makefile
+@@ -1,1 +1,1 @@
+-all:
++all: build
+`
+	batches, err := diffBatches(cfg, t.TempDir(), diff, ChunkBudget{Lines: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	var order []string
+	for _, b := range batches {
+		order = append(order, b.Lang)
+		for _, c := range b.Chunks {
+			got[c.File] = b.Lang
+		}
+	}
+	if strings.Join(order, ",") != "go,make,php,python" {
+		t.Errorf("batches should be in language order, got %v", order)
+	}
+	want := map[string]string{"main.go": "go", "web/index.php": "php", "bin/tool": "python", "Makefile": "make"}
+	for f, lang := range want {
+		if got[f] != lang {
+			t.Errorf("%s: got language %q, want %q", f, got[f], lang)
+		}
+	}
+	if _, ok := got["schema.sql"]; ok {
+		t.Error("files of no configured language should be skipped")
+	}
+}
+
+func TestShebangInterpreter(t *testing.T) {
+	for line, want := range map[string]string{
+		"#!/bin/bash -e":                   "bash",
+		"#!/usr/bin/env python3":           "python3",
+		"#!/usr/bin/env -S node --no-warn": "node",
+		"#!/usr/bin/env FOO=1 ruby":        "ruby",
+		"package main":                     "",
+	} {
+		if got := shebangInterpreter(line); got != want {
+			t.Errorf("shebangInterpreter(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+// gitRepo creates a repository in a temp dir with files committed, then applies
+// changes to the working tree.
+func gitRepo(t *testing.T, files, changes map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	writeTree(t, root, files)
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	writeTree(t, root, changes)
+	return root
+}
+
+func TestCollectBatches_DiffInSubdirectory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	gen := "// Code generated by stringer. DO NOT EDIT.\n\npackage sub\n"
+	root := gitRepo(t,
+		map[string]string{"top.go": "package top\n", "sub/a.go": "package sub\n", "sub/b.go": "package sub\n", "sub/gen.go": gen},
+		map[string]string{"top.go": "package top\n\nvar x = 1\n", "sub/a.go": "package sub\n\nvar a = 1\n", "sub/b.go": "package sub\n\nvar b = 1\n", "sub/gen.go": gen + "\nvar g = 1\n"})
+	cfg := &Config{
+		Languages: map[string]LanguageConfig{"go": {Extensions: []string{".go"}}},
+		Exclude:   []string{"/a.go"},
+	}
+	sub := filepath.Join(root, "sub")
+	batches, err := collectBatches(cfg, "diff-uncommitted", sub, "", "", ChunkBudget{Lines: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, b := range batches {
+		for _, c := range b.Chunks {
+			files = append(files, c.File)
+		}
+	}
+	if strings.Join(files, ",") != "b.go" {
+		t.Errorf("only sub/b.go should be reviewed, with a path relative to --dir; got %v", files)
+	}
+
+	// A change that only touches excluded and generated files leaves nothing to review.
+	cmd := exec.Command("git", "checkout", "--", "b.go")
+	cmd.Dir = sub
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	batches, err = collectBatches(cfg, "diff-uncommitted", sub, "", "", ChunkBudget{Lines: 100})
+	if err != nil || batches != nil {
+		t.Errorf("fully filtered diff should have nothing to review, got %v, %v", batches, err)
+	}
+}
+
+func TestDiffBatches_NoLanguageIsAnError(t *testing.T) {
+	cfg := &Config{Languages: map[string]LanguageConfig{"go": {Extensions: []string{".go"}}}}
+	diff := `diff --git a/schema.sql b/schema.sql
+--- a/schema.sql
++++ b/schema.sql
+@@ -1,1 +1,1 @@
+-CREATE TABLE a (id int);
++CREATE TABLE b (id int);
+`
+	if _, err := diffBatches(cfg, t.TempDir(), diff, ChunkBudget{Lines: 100}); err == nil {
+		t.Error("changed files of no configured language should be an error")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RunInfo is what a run reviewed: enough to collect the same code again.
+type RunInfo struct {
+	Mode string `json:"mode"`
+	Dir  string `json:"dir"`
+	Base string `json:"base,omitempty"`
+	File string `json:"file,omitempty"`
+	// ConfigHash identifies the configuration (prompts, model, chunking) of the run.
+	ConfigHash string `json:"config_hash"`
+}
+
+// RunManifest records what a run reviewed and which chunks failed, so that
+// --resume-failed can re-collect the same code and retry exactly those chunks.
+type RunManifest struct {
+	RunInfo
+	Failed []FailedChunk `json:"failed_chunks"`
+}
+
+// FailedChunk identifies a chunk that failed review by its location and content,
+// not just its position, since chunk indices shift when files change.
+type FailedChunk struct {
+	Index       int    `json:"index"`
+	Lang        string `json:"lang"`
+	File        string `json:"file"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	ContentHash string `json:"content_hash"`
+	Error       string `json:"error,omitempty"`
+	// Pending is set for chunks the run never finished, e.g. after Ctrl-C or --max-cost.
+	Pending bool `json:"pending,omitempty"`
+}
+
+func (f FailedChunk) location() string {
+	return fmt.Sprintf("%s:%d-%d", f.File, f.StartLine, f.EndLine)
+}
+
+// chunkHash hashes the text a chunk sends to the model.
+func chunkHash(c Chunk) string {
+	sum := sha256.Sum256([]byte(c.Text()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash returns a digest of the effective configuration, including command-line
+// overrides already applied to c.
+func (c *Config) Hash() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// FailedChunks lists the chunks of batches whose review failed in report, followed
+// by the pending chunks that have no result at all.
+func FailedChunks(report *Report, batches []reviewBatch) []FailedChunk {
+	type key struct {
+		lang  string
+		index int
+	}
+	results := map[key]ChunkResult{}
+	for _, res := range report.Results() {
+		results[key{res.Lang, res.Index}] = res
+	}
+	var failed, pending []FailedChunk
+	for _, b := range batches {
+		for i, c := range b.Chunks {
+			f := FailedChunk{
+				Index:       i,
+				Lang:        b.Lang,
+				File:        c.File,
+				StartLine:   c.StartLine,
+				EndLine:     c.EndLine,
+				ContentHash: chunkHash(c),
+			}
+			res, ok := results[key{b.Lang, i}]
+			switch {
+			case !ok:
+				f.Pending = true
+				pending = append(pending, f)
+			case res.Error != "":
+				f.Error = res.Error
+				failed = append(failed, f)
+			}
+		}
+	}
+	return append(failed, pending...)
+}
+
+// WriteRunManifest writes m to path as indented JSON.
+func WriteRunManifest(path string, m RunManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// ReadRunManifest reads a manifest written by WriteRunManifest.
+func ReadRunManifest(path string) (*RunManifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m RunManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s is not a run manifest (files from older versions only hold chunk indices and cannot be resumed): %w", path, err)
+	}
+	if m.Mode == "" {
+		return nil, fmt.Errorf("%s is not a run manifest: no mode", path)
+	}
+	return &m, nil
+}
+
+// ResumeBatches selects from freshly collected batches the chunks that failed in
+// m. A chunk is only resumed if its content is unchanged; failed chunks without a
+// match are returned as stale.
+func (m *RunManifest) ResumeBatches(batches []reviewBatch) ([]reviewBatch, []FailedChunk) {
+	type key struct{ lang, file, hash string }
+	byContent := map[key][]Chunk{}
+	for _, b := range batches {
+		for _, c := range b.Chunks {
+			k := key{b.Lang, c.File, chunkHash(c)}
+			byContent[k] = append(byContent[k], c)
+		}
+	}
+	var resumed []reviewBatch
+	var stale []FailedChunk
+	langIdx := map[string]int{}
+	for _, f := range m.Failed {
+		k := key{f.Lang, f.File, f.ContentHash}
+		cands := byContent[k]
+		if len(cands) == 0 {
+			stale = append(stale, f)
+			continue
+		}
+		// Identical chunks in one file are possible; prefer the same line range.
+		pick := 0
+		for i, c := range cands {
+			if c.StartLine == f.StartLine && c.EndLine == f.EndLine {
+				pick = i
+				break
+			}
+		}
+		c := cands[pick]
+		byContent[k] = append(cands[:pick:pick], cands[pick+1:]...)
+		i, ok := langIdx[f.Lang]
+		if !ok {
+			i = len(resumed)
+			langIdx[f.Lang] = i
+			resumed = append(resumed, reviewBatch{Lang: f.Lang})
+		}
+		resumed[i].Chunks = append(resumed[i].Chunks, c)
+	}
+	for i := range resumed {
+		files := map[string]bool{}
+		for _, c := range resumed[i].Chunks {
+			files[c.File] = true
+		}
+		resumed[i].Files = len(files)
+	}
+	return resumed, stale
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunManifest_RoundTripAndResume(t *testing.T) {
+	batches := []reviewBatch{
+		{Lang: "go", Chunks: []Chunk{
+			{File: "a.go", StartLine: 1, EndLine: 10, Content: "func A() {}"},
+			{File: "a.go", StartLine: 11, EndLine: 20, Content: "func B() {}"},
+			{File: "b.go", StartLine: 1, EndLine: 5, Content: "func C() {}"},
+		}},
+		{Lang: "php", Chunks: []Chunk{{File: "x.php", StartLine: 1, EndLine: 3, Content: "<?php echo 1;"}}},
+	}
+	report := NewReport("review-project", "fake", "m")
+	report.Add(ChunkResult{Index: 0, Lang: "go", File: "a.go"})
+	report.Add(ChunkResult{Index: 1, Lang: "go", File: "a.go", Error: "timeout"})
+	report.Add(ChunkResult{Index: 2, Lang: "go", File: "b.go", Error: "500"})
+	report.Add(ChunkResult{Index: 0, Lang: "php", File: "x.php", Error: "500"})
+
+	cfg := testLoopConfig()
+	path := filepath.Join(t.TempDir(), "failed.json")
+	m := RunManifest{RunInfo: RunInfo{Mode: "review-project", Dir: ".", ConfigHash: cfg.Hash()}, Failed: FailedChunks(report, batches)}
+	if err := WriteRunManifest(path, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRunManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode != "review-project" || got.ConfigHash != cfg.Hash() || len(got.Failed) != 3 {
+		t.Fatalf("unexpected manifest: %+v", got)
+	}
+	if f := got.Failed[0]; f.Lang != "go" || f.File != "a.go" || f.StartLine != 11 || f.ContentHash != chunkHash(batches[0].Chunks[1]) {
+		t.Errorf("unexpected failed chunk: %+v", f)
+	}
+
+	// b.go changed and a new chunk was inserted before a.go's failed one.
+	fresh := []reviewBatch{
+		{Lang: "go", Chunks: []Chunk{
+			{File: "a.go", StartLine: 1, EndLine: 10, Content: "func New() {}"},
+			{File: "a.go", StartLine: 11, EndLine: 20, Content: "func A() {}"},
+			{File: "a.go", StartLine: 21, EndLine: 30, Content: "func B() {}"},
+			{File: "b.go", StartLine: 1, EndLine: 5, Content: "func C() { changed() }"},
+		}},
+		batches[1],
+	}
+	resumed, stale := got.ResumeBatches(fresh)
+	if len(stale) != 1 || stale[0].File != "b.go" {
+		t.Errorf("expected b.go to be stale, got %+v", stale)
+	}
+	if len(resumed) != 2 || resumed[0].Lang != "go" || len(resumed[0].Chunks) != 1 || resumed[0].Chunks[0].Content != "func B() {}" || resumed[1].Lang != "php" {
+		t.Errorf("unexpected resumed batches: %+v", resumed)
+	}
+}
+
+func TestReadRunManifest_OldFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.json")
+	if err := os.WriteFile(path, []byte(`[{"index":3,"error":"timeout"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRunManifest(path); err == nil || !strings.Contains(err.Error(), "older versions") {
+		t.Errorf("expected an error explaining the old format, got %v", err)
+	}
+}
+
+func TestFailedChunks_PendingAfterCancel(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	p := &fakeProvider{delay: func(user string) time.Duration {
+		if codeNum(user) == 0 {
+			return 0
+		}
+		return 10 * time.Second
+	}}
+	l := &LLMClient{provider: p}
+	chunks := []Chunk{{File: "a.go", Content: "code-0"}, {File: "a.go", Content: "code-1"}, {File: "b.go", Content: "code-2"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report := NewReport("review-project", "fake", "fake-model")
+	start := time.Now()
+	opts := ReviewOptions{ChunkTimeout: time.Minute, MaxRetries: 1, Concurrency: 1}
+	if err := l.ReviewAndFixLoop(ctx, testLoopConfig(), "go", chunks, opts, report); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancellation should abort the request in flight, took %v", elapsed)
+	}
+	if n := len(report.Results()); n != 1 {
+		t.Errorf("only the finished chunk belongs in the report, got %d", n)
+	}
+	failed := FailedChunks(report, []reviewBatch{{Lang: "go", Chunks: chunks}})
+	if len(failed) != 2 || !failed[0].Pending || failed[0].Index != 1 || failed[1].File != "b.go" {
+		t.Errorf("expected chunks 1 and 2 pending, got %+v", failed)
+	}
+}
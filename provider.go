@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxTokens is the completion budget used when a model has no
+// max_output_tokens configured in [models].
+const defaultMaxTokens = 2048
+
+// ChatRequest is a single system+user exchange sent to an LLM backend.
+type ChatRequest struct {
+	System    string
+	User      string
+	MaxTokens int
+	// Schema, when set, asks for a JSON reply. Backends that support structured
+	// output constrain the reply to the schema; others rely on the prompt.
+	Schema json.RawMessage
+}
+
+// ChatResponse is the assistant reply to a ChatRequest. Usage is zero when the
+// backend did not report token counts.
+type ChatResponse struct {
+	Content string
+	Usage   Usage
+	// Cached is set when the reply came from the ReviewCache instead of the backend.
+	Cached bool
+}
+
+// Provider is implemented by every LLM backend.
+type Provider interface {
+	// Name returns the identifier the provider is registered under.
+	Name() string
+	// Model returns the model name requests are sent to.
+	Model() string
+	// Chat sends a chat request and returns the assistant reply.
+	Chat(ctx context.Context, req ChatRequest) (ChatResponse, error)
+	// HealthCheck checks if the backend is reachable and usable.
+	HealthCheck(ctx context.Context) error
+	// ListModels returns the models available on the backend.
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// StreamingProvider is implemented by providers that can deliver replies incrementally.
+type StreamingProvider interface {
+	// ChatStream sends a chat request, calling onToken for every text delta, and
+	// returns the complete reply.
+	ChatStream(ctx context.Context, req ChatRequest, onToken func(string)) (ChatResponse, error)
+}
+
+// ConcurrencyLimiter is implemented by providers that handle only a limited number
+// of requests in parallel. [llm] max_concurrency overrides the limit.
+type ConcurrencyLimiter interface {
+	// MaxConcurrency returns the number of chat requests worth running at once.
+	MaxConcurrency() int
+}
+
+// ProviderFactory builds a Provider from the loaded config.
+type ProviderFactory func(cfg *Config, apiKey string) (Provider, error)
+
+var providers = map[string]ProviderFactory{}
+
+// RegisterProvider makes a backend selectable via llm_provider. It is meant to be
+// called from init functions and panics on duplicate names.
+func RegisterProvider(name string, factory ProviderFactory) {
+	if _, ok := providers[name]; ok {
+		panic("provider already registered: " + name)
+	}
+	providers[name] = factory
+}
+
+// ProviderNames returns the registered provider names in sorted order.
+func ProviderNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider builds the provider selected by cfg.LLMProvider, defaulting to openai,
+// for the model of cfg.modelName(), which also sets the chunk budget and prices.
+func NewProvider(cfg *Config, apiKey string) (Provider, error) {
+	name := cfg.LLMProvider
+	if name == "" {
+		name = "openai"
+	}
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown llm provider %q (supported: %v)", name, ProviderNames())
+	}
+	if cfg.modelName() == "" {
+		return nil, fmt.Errorf("%s provider requires llm_model (or model)", name)
+	}
+	return factory(cfg, apiKey)
+}
+
+// chatMessage is the role/content pair shared by the OpenAI-style JSON APIs.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatUsage is the usage object of OpenAI-style chat completion responses.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u chatUsage) toUsage() Usage {
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+// ProviderError is returned for error responses from an LLM backend.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Message    string
+	Retryable  bool
+	// RetryAfter is how long the server asked clients to wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("%s status %d (%s): %s", e.Provider, e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("%s status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// IsRetryable reports whether err may succeed on retry. Errors that are not
+// ProviderErrors (network failures, timeouts) are treated as retryable.
+func IsRetryable(err error) bool {
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.Retryable
+	}
+	return true
+}
+
+// retryAfter returns the wait requested by the server for err, or 0.
+func retryAfter(err error) time.Duration {
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.RetryAfter
+	}
+	return 0
+}
+
+// retryableStatus reports whether a request that failed with an HTTP status is
+// worth retrying: rate limits, request timeouts and server errors (including
+// Anthropic's 529 overload). Other 4xx responses are fatal.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// newStatusError maps a non-200 response to a ProviderError, taking the message from
+// an OpenAI-style {"error": {"type", "message"}}, an Ollama-style {"error": "..."}
+// body or the raw body text.
+func newStatusError(provider string, resp *http.Response) *ProviderError {
+	perr := &ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Retryable:  retryableStatus(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var structured struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && len(structured.Error) > 0 {
+		var detail struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(structured.Error, &detail) == nil {
+			perr.Type, perr.Message = detail.Type, detail.Message
+		} else {
+			_ = json.Unmarshal(structured.Error, &perr.Message)
+		}
+	}
+	if perr.Message == "" {
+		perr.Message = strings.TrimSpace(string(body))
+		if len(perr.Message) > 200 {
+			perr.Message = perr.Message[:200] + "..."
+		}
+	}
+	if perr.Message == "" {
+		perr.Message = http.StatusText(resp.StatusCode)
+	}
+	return perr
+}
+
+// parseRetryAfter reads the wait requested by a Retry-After header (seconds or an
+// HTTP date) or OpenAI's retry-after-ms header, returning 0 when absent.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
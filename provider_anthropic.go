@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("anthropic", newAnthropicProvider)
+}
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+)
+
+type anthropicProvider struct {
+	model      string
+	apiKey     string
+	apiKeyEnv  string
+	apiVersion string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// newAnthropicProvider reads its key from ANTHROPIC_API_KEY (or llm.api_key_env);
+// the apiKey argument carries the OpenAI key and is ignored. The endpoint comes
+// from llm.base_url, then ANTHROPIC_BASE_URL, and llm.api_version overrides the
+// anthropic-version header.
+func newAnthropicProvider(cfg *Config, _ string) (Provider, error) {
+	httpClient, err := newHTTPClient(cfg.LLM, "")
+	if err != nil {
+		return nil, err
+	}
+	baseURL := cfg.LLM.BaseURL
+	if baseURL == "" {
+		baseURL = os.Getenv("ANTHROPIC_BASE_URL")
+	}
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	apiKeyEnv := "ANTHROPIC_API_KEY"
+	if cfg.LLM.APIKeyEnv != "" {
+		apiKeyEnv = cfg.LLM.APIKeyEnv
+	}
+	apiVersion := anthropicVersion
+	if cfg.LLM.APIVersion != "" {
+		apiVersion = cfg.LLM.APIVersion
+	}
+	return &anthropicProvider{
+		model:      cfg.modelName(),
+		apiKey:     os.Getenv(apiKeyEnv),
+		apiKeyEnv:  apiKeyEnv,
+		apiVersion: apiVersion,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+func (p *anthropicProvider) Name() string  { return "anthropic" }
+func (p *anthropicProvider) Model() string { return p.model }
+
+// MaxConcurrency is kept low so parallel reviews stay within the rate limits of lower usage tiers.
+func (p *anthropicProvider) MaxConcurrency() int { return 4 }
+
+func (p *anthropicProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	body := map[string]interface{}{
+		"model":      p.model,
+		"max_tokens": req.MaxTokens,
+		"system":     req.System,
+		"messages":   []chatMessage{{Role: "user", Content: req.User}},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewReader(b))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	var respBody struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := p.do(httpReq, &respBody); err != nil {
+		return ChatResponse{}, err
+	}
+	var sb strings.Builder
+	for _, block := range respBody.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	if sb.Len() == 0 {
+		return ChatResponse{}, fmt.Errorf("no response from LLM")
+	}
+	return ChatResponse{
+		Content: sb.String(),
+		Usage:   Usage{PromptTokens: respBody.Usage.InputTokens, CompletionTokens: respBody.Usage.OutputTokens},
+	}, nil
+}
+
+// HealthCheck verifies the key is set and accepted by listing models.
+func (p *anthropicProvider) HealthCheck(ctx context.Context) error {
+	if p.apiKey == "" {
+		return fmt.Errorf("%s is not set", p.apiKeyEnv)
+	}
+	if _, err := p.ListModels(ctx); err != nil {
+		return fmt.Errorf("anthropic health check failed: %w", err)
+	}
+	return nil
+}
+
+func (p *anthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := p.do(req, &list); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+func (p *anthropicProvider) do(req *http.Request, out interface{}) error {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", p.apiVersion)
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return anthropicError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// anthropicError maps an error response to a ProviderError. Rate limits (429),
+// overload (529) and server errors are retryable; everything else is fatal.
+func anthropicError(resp *http.Response) error {
+	perr := newStatusError("anthropic", resp)
+	switch perr.Type {
+	case "overloaded_error", "rate_limit_error", "api_error":
+		perr.Retryable = true
+	}
+	return perr
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestAnthropic(t *testing.T, handler http.HandlerFunc) Provider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	t.Setenv("ANTHROPIC_BASE_URL", srv.URL)
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	p, err := newAnthropicProvider(&Config{LLMModel: "claude-sonnet-4-5"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAnthropic_Chat(t *testing.T) {
+	p := newTestAnthropic(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			System   string        `json:"system"`
+			Messages []chatMessage `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.System != "sys" || len(body.Messages) != 1 || body.Messages[0].Role != "user" {
+			http.Error(w, "unexpected body", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "LGTM"}},
+			"usage":   map[string]int{"input_tokens": 120, "output_tokens": 3},
+		})
+	})
+	out, err := p.Chat(context.Background(), ChatRequest{System: "sys", User: "code", MaxTokens: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Content != "LGTM" {
+		t.Errorf("unexpected reply %q", out.Content)
+	}
+	if out.Usage != (Usage{PromptTokens: 120, CompletionTokens: 3}) {
+		t.Errorf("unexpected usage %+v", out.Usage)
+	}
+}
+
+func TestAnthropic_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		status    int
+		errType   string
+		retryable bool
+	}{
+		{529, "overloaded_error", true},
+		{429, "rate_limit_error", true},
+		{401, "authentication_error", false},
+		{400, "invalid_request_error", false},
+	}
+	for _, tc := range cases {
+		p := newTestAnthropic(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"type":  "error",
+				"error": map[string]string{"type": tc.errType, "message": "nope"},
+			})
+		})
+		_, err := p.Chat(context.Background(), ChatRequest{System: "sys", User: "code", MaxTokens: 64})
+		if err == nil {
+			t.Fatalf("%s: expected error", tc.errType)
+		}
+		if IsRetryable(err) != tc.retryable {
+			t.Errorf("%s: IsRetryable = %v, want %v", tc.errType, !tc.retryable, tc.retryable)
+		}
+	}
+}
+
+func TestAnthropic_HealthCheckRequiresKey(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	p, err := newAnthropicProvider(&Config{LLMModel: "claude-sonnet-4-5"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.HealthCheck(context.Background()); err == nil {
+		t.Fatal("expected error without ANTHROPIC_API_KEY")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("lmstudio", newLMStudioProvider)
+}
+
+const lmstudioDefaultBaseURL = "http://127.0.0.1:1234/v1"
+
+type lmstudioProvider struct {
+	model      string
+	apiKey     string
+	orgID      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// newLMStudioProvider also serves any OpenAI-compatible server via llm.base_url.
+// The API key is only sent when llm.api_key_env is configured.
+func newLMStudioProvider(cfg *Config, apiKey string) (Provider, error) {
+	httpClient, err := newHTTPClient(cfg.LLM, cfg.LLM.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := lmstudioDefaultBaseURL
+	if cfg.LLM.BaseURL != "" {
+		baseURL = cfg.LLM.BaseURL
+	}
+	return &lmstudioProvider{
+		model:      cfg.modelName(),
+		apiKey:     resolveAPIKey(cfg.LLM, ""),
+		orgID:      cfg.LLM.OrgID,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+func (p *lmstudioProvider) Name() string  { return "lmstudio" }
+func (p *lmstudioProvider) Model() string { return p.model }
+
+// MaxConcurrency is 1: LM Studio serves one request at a time and queues the rest.
+func (p *lmstudioProvider) MaxConcurrency() int { return 1 }
+
+// chatBody builds an OpenAI-style chat completion request body.
+func (p *lmstudioProvider) chatBody(req ChatRequest, stream bool) map[string]interface{} {
+	body := map[string]interface{}{
+		"model": p.model,
+		"messages": []chatMessage{
+			{Role: "system", Content: req.System},
+			{Role: "user", Content: req.User},
+		},
+		"max_tokens": req.MaxTokens,
+	}
+	if stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if req.Schema != nil {
+		body["response_format"] = map[string]interface{}{
+			"type":        "json_schema",
+			"json_schema": map[string]interface{}{"name": "review", "strict": true, "schema": req.Schema},
+		}
+	}
+	return body
+}
+
+func (p *lmstudioProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	b, err := json.Marshal(p.chatBody(req, false))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.setAuth(httpReq)
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return ChatResponse{}, newStatusError("lmstudio", resp)
+	}
+	var respBody struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+		Usage chatUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return ChatResponse{}, err
+	}
+	if len(respBody.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("no response from LLM")
+	}
+	return ChatResponse{Content: respBody.Choices[0].Message.Content, Usage: respBody.Usage.toUsage()}, nil
+}
+
+func (p *lmstudioProvider) ChatStream(ctx context.Context, req ChatRequest, onToken func(string)) (ChatResponse, error) {
+	b, err := json.Marshal(p.chatBody(req, true))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	p.setAuth(httpReq)
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return ChatResponse{}, newStatusError("lmstudio", resp)
+	}
+	var sb strings.Builder
+	var usage Usage
+	err = readSSE(resp.Body, func(data []byte) error {
+		var chunk struct {
+			Choices []struct {
+				Delta chatMessage `json:"delta"`
+			} `json:"choices"`
+			Usage *chatUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				sb.WriteString(choice.Delta.Content)
+				onToken(choice.Delta.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatResponse{Content: sb.String(), Usage: usage}, err
+	}
+	if sb.Len() == 0 {
+		return ChatResponse{}, fmt.Errorf("no response from LLM")
+	}
+	return ChatResponse{Content: sb.String(), Usage: usage}, nil
+}
+
+// HealthCheck verifies LM Studio is reachable and knows the configured model.
+func (p *lmstudioProvider) HealthCheck(ctx context.Context) error {
+	models, err := p.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("lmstudio health check failed: %w (check %s/models in your browser)", err, p.baseURL)
+	}
+	for _, m := range models {
+		if m == p.model {
+			return nil
+		}
+	}
+	return fmt.Errorf("lmstudio model %q is not available (available: %v)", p.model, models)
+}
+
+func (p *lmstudioProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setAuth(req)
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status: %d", resp.StatusCode)
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+func (p *lmstudioProvider) setAuth(req *http.Request) {
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	if p.orgID != "" {
+		req.Header.Set("OpenAI-Organization", p.orgID)
+	}
+}
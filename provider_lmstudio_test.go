@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLMStudio_SendsOrgAndAuthHeaders(t *testing.T) {
+	t.Setenv("TEST_LMSTUDIO_KEY", "secret")
+	var org, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		org, auth = r.Header.Get("OpenAI-Organization"), r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := &Config{LLMModel: "m", LLM: LLMConfig{BaseURL: srv.URL, OrgID: "org-123", APIKeyEnv: "TEST_LMSTUDIO_KEY"}}
+	p, err := newLMStudioProvider(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chat(context.Background(), ChatRequest{System: "s", User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	if org != "org-123" || auth != "Bearer secret" {
+		t.Errorf("unexpected headers: OpenAI-Organization=%q Authorization=%q", org, auth)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("ollama", newOllamaProvider)
+}
+
+const ollamaDefaultBaseURL = "http://127.0.0.1:11434"
+
+type ollamaProvider struct {
+	model       string
+	baseURL     string
+	numCtx      int
+	keepAlive   string
+	pullMissing bool
+	httpClient  *http.Client
+}
+
+func newOllamaProvider(cfg *Config, apiKey string) (Provider, error) {
+	httpClient, err := newHTTPClient(cfg.LLM, "")
+	if err != nil {
+		return nil, err
+	}
+	baseURL := cfg.Ollama.BaseURL
+	if baseURL == "" {
+		baseURL = ollamaDefaultBaseURL
+	}
+	return &ollamaProvider{
+		model:       cfg.modelName(),
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		numCtx:      cfg.Ollama.NumCtx,
+		keepAlive:   cfg.Ollama.KeepAlive,
+		pullMissing: cfg.Ollama.PullMissing,
+		httpClient:  httpClient,
+	}, nil
+}
+
+func (p *ollamaProvider) Name() string  { return "ollama" }
+func (p *ollamaProvider) Model() string { return p.model }
+
+// MaxConcurrency is 1 to match the default OLLAMA_NUM_PARALLEL on most machines.
+func (p *ollamaProvider) MaxConcurrency() int { return 1 }
+
+func (p *ollamaProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	options := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if p.numCtx > 0 {
+		options["num_ctx"] = p.numCtx
+	}
+	body := map[string]interface{}{
+		"model": p.model,
+		"messages": []chatMessage{
+			{Role: "system", Content: req.System},
+			{Role: "user", Content: req.User},
+		},
+		"stream":  false,
+		"options": options,
+	}
+	if p.keepAlive != "" {
+		body["keep_alive"] = p.keepAlive
+	}
+	if req.Schema != nil {
+		body["format"] = req.Schema
+	}
+	var respBody struct {
+		Message         chatMessage `json:"message"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+		EvalCount       int         `json:"eval_count"`
+	}
+	if err := p.post(ctx, "/api/chat", body, &respBody); err != nil {
+		return ChatResponse{}, err
+	}
+	return ChatResponse{
+		Content: respBody.Message.Content,
+		Usage:   Usage{PromptTokens: respBody.PromptEvalCount, CompletionTokens: respBody.EvalCount},
+	}, nil
+}
+
+// HealthCheck verifies the server is up and the configured model is installed,
+// pulling it first when pull_missing is enabled.
+func (p *ollamaProvider) HealthCheck(ctx context.Context) error {
+	models, err := p.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("ollama health check failed: %w (is `ollama serve` running at %s?)", err, p.baseURL)
+	}
+	if ollamaHasModel(models, p.model) {
+		return nil
+	}
+	if !p.pullMissing {
+		return fmt.Errorf("ollama model %q is not installed (run `ollama pull %s` or set pull_missing = true)", p.model, p.model)
+	}
+	log.Printf("[ollama] Pulling missing model %s...", p.model)
+	return p.Pull(ctx, p.model)
+}
+
+func (p *ollamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("ollama status %d", resp.StatusCode)
+	}
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range tags.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// Pull downloads a model into the local Ollama store and blocks until it completes.
+func (p *ollamaProvider) Pull(ctx context.Context, model string) error {
+	var respBody struct {
+		Status string `json:"status"`
+	}
+	if err := p.post(ctx, "/api/pull", map[string]interface{}{"model": model, "stream": false}, &respBody); err != nil {
+		return fmt.Errorf("ollama pull %s: %w", model, err)
+	}
+	if respBody.Status != "success" {
+		return fmt.Errorf("ollama pull %s: unexpected status %q", model, respBody.Status)
+	}
+	return nil
+}
+
+func (p *ollamaProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return newStatusError("ollama", resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ollamaHasModel reports whether model is installed. Ollama reports names with
+// an explicit tag, so "llama3" matches "llama3:latest".
+func ollamaHasModel(installed []string, model string) bool {
+	if !strings.Contains(model, ":") {
+		model += ":latest"
+	}
+	for _, m := range installed {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
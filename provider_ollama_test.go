@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestOllama(t *testing.T, installed ...string) (*ollamaProvider, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			var models []map[string]string
+			for _, name := range installed {
+				models = append(models, map[string]string{"name": name})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"models": models})
+		case "/api/chat":
+			var body struct {
+				Model     string                 `json:"model"`
+				Stream    bool                   `json:"stream"`
+				KeepAlive string                 `json:"keep_alive"`
+				Options   map[string]interface{} `json:"options"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body.Stream || body.KeepAlive != "5m" || body.Options["num_ctx"] != float64(4096) {
+				http.Error(w, `{"error":"unexpected request"}`, http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":           map[string]string{"role": "assistant", "content": "looks good"},
+				"done":              true,
+				"prompt_eval_count": 42,
+				"eval_count":        7,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cfg := &Config{LLMModel: "llama3", Ollama: OllamaConfig{BaseURL: srv.URL, NumCtx: 4096, KeepAlive: "5m"}}
+	p, err := newOllamaProvider(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*ollamaProvider), srv
+}
+
+func TestOllama_HealthCheckInstalledModel(t *testing.T) {
+	p, _ := newTestOllama(t, "llama3:latest")
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("expected healthy, got %v", err)
+	}
+}
+
+func TestOllama_HealthCheckMissingModel(t *testing.T) {
+	p, _ := newTestOllama(t, "qwen2.5-coder:7b")
+	err := p.HealthCheck(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Fatalf("expected missing model error, got %v", err)
+	}
+}
+
+func TestOllama_Chat(t *testing.T) {
+	p, _ := newTestOllama(t, "llama3:latest")
+	out, err := p.Chat(context.Background(), ChatRequest{System: "sys", User: "code", MaxTokens: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Content != "looks good" {
+		t.Errorf("unexpected reply %q", out.Content)
+	}
+	if out.Usage != (Usage{PromptTokens: 42, CompletionTokens: 7}) {
+		t.Errorf("unexpected usage %+v", out.Usage)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	RegisterProvider("openai", newOpenAIProvider)
+}
+
+const (
+	azureDefaultAPIVersion = "2024-06-01"
+	azureDefaultAPIKeyEnv  = "AZURE_OPENAI_API_KEY"
+)
+
+type openAIProvider struct {
+	model      string
+	apiKey     string
+	apiKeyEnv  string
+	deployment string
+	client     *openai.Client
+}
+
+func newOpenAIProvider(cfg *Config, apiKey string) (Provider, error) {
+	model := cfg.modelName()
+	if cfg.Azure.Endpoint != "" {
+		return newAzureOpenAIProvider(cfg, model)
+	}
+	httpClient, err := newHTTPClient(cfg.LLM, cfg.LLM.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	apiKeyEnv := "OPENAI_API_KEY"
+	if cfg.LLM.APIKeyEnv != "" {
+		apiKeyEnv = cfg.LLM.APIKeyEnv
+	}
+	apiKey = resolveAPIKey(cfg.LLM, apiKey)
+	clientCfg := openai.DefaultConfig(apiKey)
+	if cfg.LLM.BaseURL != "" {
+		clientCfg.BaseURL = strings.TrimRight(cfg.LLM.BaseURL, "/")
+	}
+	clientCfg.OrgID = cfg.LLM.OrgID
+	clientCfg.HTTPClient = withRetryAfterCapture(httpClient)
+	return &openAIProvider{
+		model:     model,
+		apiKey:    apiKey,
+		apiKeyEnv: apiKeyEnv,
+		client:    openai.NewClientWithConfig(clientCfg),
+	}, nil
+}
+
+// newAzureOpenAIProvider targets an Azure OpenAI deployment. Every request is routed
+// to the configured deployment regardless of the model name, and authenticated with
+// the api-key header.
+func newAzureOpenAIProvider(cfg *Config, model string) (Provider, error) {
+	az := cfg.Azure
+	if az.Deployment == "" {
+		return nil, fmt.Errorf("azure.deployment is required when azure.endpoint is set")
+	}
+	httpClient, err := newHTTPClient(cfg.LLM, "")
+	if err != nil {
+		return nil, err
+	}
+	apiKeyEnv := azureDefaultAPIKeyEnv
+	if az.APIKeyEnv != "" {
+		apiKeyEnv = az.APIKeyEnv
+	}
+	apiKey := os.Getenv(apiKeyEnv)
+	clientCfg := openai.DefaultAzureConfig(apiKey, strings.TrimRight(az.Endpoint, "/"))
+	clientCfg.APIVersion = azureDefaultAPIVersion
+	if az.APIVersion != "" {
+		clientCfg.APIVersion = az.APIVersion
+	}
+	clientCfg.AzureModelMapperFunc = func(string) string { return az.Deployment }
+	clientCfg.HTTPClient = withRetryAfterCapture(httpClient)
+	return &openAIProvider{
+		model:      model,
+		apiKey:     apiKey,
+		apiKeyEnv:  apiKeyEnv,
+		deployment: az.Deployment,
+		client:     openai.NewClientWithConfig(clientCfg),
+	}, nil
+}
+
+func (p *openAIProvider) Name() string  { return "openai" }
+func (p *openAIProvider) Model() string { return p.model }
+
+func (p *openAIProvider) MaxConcurrency() int { return 8 }
+
+func (p *openAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	ctx, wait := captureRetryAfter(ctx)
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: p.model,
+		Messages: []openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		}, {
+			Role:    openai.ChatMessageRoleUser,
+			Content: req.User,
+		}},
+		MaxTokens:      req.MaxTokens,
+		ResponseFormat: openAIResponseFormat(req),
+	})
+	if err != nil {
+		return ChatResponse{}, openAIError(err, *wait)
+	}
+	if len(resp.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("no response from LLM")
+	}
+	return ChatResponse{
+		Content: resp.Choices[0].Message.Content,
+		Usage:   Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens},
+	}, nil
+}
+
+func (p *openAIProvider) ChatStream(ctx context.Context, req ChatRequest, onToken func(string)) (ChatResponse, error) {
+	ctx, wait := captureRetryAfter(ctx)
+	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model: p.model,
+		Messages: []openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		}, {
+			Role:    openai.ChatMessageRoleUser,
+			Content: req.User,
+		}},
+		MaxTokens:      req.MaxTokens,
+		ResponseFormat: openAIResponseFormat(req),
+		StreamOptions:  p.streamOptions(),
+	})
+	if err != nil {
+		return ChatResponse{}, openAIError(err, *wait)
+	}
+	defer stream.Close()
+	var sb strings.Builder
+	var usage Usage
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ChatResponse{Content: sb.String(), Usage: usage}, err
+		}
+		if resp.Usage != nil {
+			usage = Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+		}
+		for _, choice := range resp.Choices {
+			if choice.Delta.Content != "" {
+				sb.WriteString(choice.Delta.Content)
+				onToken(choice.Delta.Content)
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return ChatResponse{}, fmt.Errorf("no response from LLM")
+	}
+	return ChatResponse{Content: sb.String(), Usage: usage}, nil
+}
+
+// streamOptions asks for a final usage chunk. Azure deployments on older API
+// versions reject stream_options, so it is only sent to OpenAI-compatible endpoints.
+func (p *openAIProvider) streamOptions() *openai.StreamOptions {
+	if p.deployment != "" {
+		return nil
+	}
+	return &openai.StreamOptions{IncludeUsage: true}
+}
+
+// HealthCheck for OpenAI assumes the API is reachable if apiKey is set. For Azure it
+// sends a one-token completion to verify the deployment exists and the key is accepted.
+func (p *openAIProvider) HealthCheck(ctx context.Context) error {
+	if p.apiKey == "" {
+		return fmt.Errorf("%s is not set", p.apiKeyEnv)
+	}
+	if p.deployment == "" {
+		return nil
+	}
+	_, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     p.model,
+		Messages:  []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping"}},
+		MaxTokens: 1,
+	})
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusNotFound {
+		return fmt.Errorf("azure deployment %q not found: %s", p.deployment, apiErr.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("azure health check failed: %w", err)
+	}
+	return nil
+}
+
+func (p *openAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range list.Models {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// openAIResponseFormat requests JSON mode for structured replies. This SDK version
+// has no json_schema support, so the schema itself is conveyed by the prompt.
+func openAIResponseFormat(req ChatRequest) *openai.ChatCompletionResponseFormat {
+	if req.Schema == nil {
+		return nil
+	}
+	return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+}
+
+// openAIError maps go-openai errors to a ProviderError so they are classified like
+// every other provider. A 429 for an exhausted quota is not retryable.
+func openAIError(err error, retryAfter time.Duration) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &ProviderError{
+			Provider:   "openai",
+			StatusCode: apiErr.HTTPStatusCode,
+			Type:       apiErr.Type,
+			Message:    apiErr.Message,
+			Retryable:  retryableStatus(apiErr.HTTPStatusCode) && apiErr.Type != "insufficient_quota",
+			RetryAfter: retryAfter,
+		}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &ProviderError{
+			Provider:   "openai",
+			StatusCode: reqErr.HTTPStatusCode,
+			Message:    reqErr.Err.Error(),
+			Retryable:  retryableStatus(reqErr.HTTPStatusCode),
+			RetryAfter: retryAfter,
+		}
+	}
+	return err
+}
+
+// go-openai does not expose response headers on errors, so the transport records
+// Retry-After into a slot carried by the request context.
+type retryAfterKey struct{}
+
+func captureRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	wait := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, wait), wait
+}
+
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if wait, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok && err == nil {
+		*wait = parseRetryAfter(resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+func withRetryAfterCapture(c *http.Client) *http.Client {
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &retryAfterTransport{base: base}
+	return c
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAzure(t *testing.T, handler http.HandlerFunc) Provider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	t.Setenv("AZURE_OPENAI_API_KEY", "azure-key")
+	cfg := &Config{Model: "gpt-4o", Azure: AzureConfig{Endpoint: srv.URL, Deployment: "review-gpt4o", APIVersion: "2024-06-01"}}
+	p, err := newOpenAIProvider(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAzure_HealthCheckDeploymentExists(t *testing.T) {
+	p := newTestAzure(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/review-gpt4o/chat/completions" ||
+			r.URL.Query().Get("api-version") != "2024-06-01" || r.Header.Get("api-key") != "azure-key" {
+			http.Error(w, `{"error":{"code":"BadRequest","message":"unexpected request"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"p"}}]}`))
+	})
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("expected healthy, got %v", err)
+	}
+}
+
+func TestAzure_HealthCheckMissingDeployment(t *testing.T) {
+	p := newTestAzure(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":"DeploymentNotFound","message":"The API deployment for this resource does not exist."}}`))
+	})
+	err := p.HealthCheck(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected deployment not found error, got %v", err)
+	}
+}
+
+func TestOpenAI_RateLimitErrors(t *testing.T) {
+	cases := []struct {
+		status     int
+		body       string
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{429, `{"error":{"type":"requests","message":"Rate limit reached"}}`, true, 7 * time.Second},
+		{429, `{"error":{"type":"insufficient_quota","message":"You exceeded your current quota"}}`, false, 7 * time.Second},
+		{503, `{"error":{"type":"server_error","message":"overloaded"}}`, true, 7 * time.Second},
+		{400, `{"error":{"type":"invalid_request_error","message":"bad"}}`, false, 7 * time.Second},
+	}
+	for _, tc := range cases {
+		p := newTestAzure(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte(tc.body))
+		})
+		_, err := p.Chat(context.Background(), ChatRequest{System: "sys", User: "code", MaxTokens: 64})
+		var perr *ProviderError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%d: expected ProviderError, got %v", tc.status, err)
+		}
+		if perr.Retryable != tc.retryable || perr.RetryAfter != tc.retryAfter || perr.StatusCode != tc.status {
+			t.Errorf("%d %s: got %+v", tc.status, perr.Type, perr)
+		}
+	}
+}
+
+func TestOpenAI_ModelIgnoresLLMModel(t *testing.T) {
+	cfg := &Config{Model: "gpt-4o", LLMModel: "local-gemma"}
+	p, err := newOpenAIProvider(cfg, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Model() != "gpt-4o" {
+		t.Errorf("openai should use model, not the local llm_model; got %q", p.Model())
+	}
+	cfg.LLMProvider = "lmstudio"
+	if got := cfg.modelName(); got != "local-gemma" {
+		t.Errorf("other providers should use llm_model; got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewProvider_Unknown(t *testing.T) {
+	_, err := NewProvider(&Config{LLMProvider: "bogus"}, "")
+	if err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+	for _, name := range ProviderNames() {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error should list supported provider %q: %v", name, err)
+		}
+	}
+}
+
+func TestNewProvider_DefaultsToOpenAI(t *testing.T) {
+	p, err := NewProvider(&Config{Model: "gpt-4o"}, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name() != "openai" {
+		t.Errorf("empty llm_provider should select openai, got %q", p.Name())
+	}
+}
+
+func TestRegisterProvider_DuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a provider name twice should panic")
+		}
+	}()
+	RegisterProvider("openai", newOpenAIProvider)
+}
+
+func TestNewProvider_ModelFallsBackToModel(t *testing.T) {
+	for _, name := range []string{"lmstudio", "ollama", "anthropic"} {
+		cfg := &Config{LLMProvider: name, Model: "shared-model"}
+		p, err := NewProvider(cfg, "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if p.Model() != cfg.modelName() || p.Model() != "shared-model" {
+			t.Errorf("%s sends %q, but budgets and prices use %q", name, p.Model(), cfg.modelName())
+		}
+	}
+	if _, err := NewProvider(&Config{LLMProvider: "lmstudio"}, ""); err == nil {
+		t.Error("a provider without any model should be an error")
+	}
+}
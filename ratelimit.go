@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at rate units per second up to capacity. Reservations may
+// drive it negative; the deficit is the time the caller has to wait.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	level    float64
+	last     time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(perMinute) / 60, capacity: float64(perMinute), level: float64(perMinute), last: now}
+}
+
+// reserve takes n units (at most one minute's worth) and returns how long to wait
+// before they are available.
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.level = min(b.capacity, b.level+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.level -= min(n, b.capacity)
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refund(n float64) {
+	if b != nil {
+		b.level += min(n, b.capacity)
+	}
+}
+
+// rateLimiter is shared by every request of an LLMClient. It enforces the
+// requests-per-minute and tokens-per-minute limits from [llm], and holds all
+// requests back after the server asks for a pause with Retry-After. A nil
+// rateLimiter does not limit.
+type rateLimiter struct {
+	mu          sync.Mutex
+	requests    *tokenBucket
+	tokens      *tokenBucket
+	pausedUntil time.Time
+}
+
+func newRateLimiter(requestsPerMinute, tokensPerMinute int) *rateLimiter {
+	now := time.Now()
+	return &rateLimiter{
+		requests: newTokenBucket(requestsPerMinute, now),
+		tokens:   newTokenBucket(tokensPerMinute, now),
+	}
+}
+
+// Wait blocks until a request costing tokens may be sent, or ctx is done.
+func (r *rateLimiter) Wait(ctx context.Context, tokens int) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	wait := max(r.requests.reserve(1, now), r.tokens.reserve(float64(tokens), now), r.pausedUntil.Sub(now))
+	r.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		r.requests.refund(1)
+		r.tokens.refund(float64(tokens))
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Pause holds back every request for d, e.g. after a 429 with Retry-After.
+func (r *rateLimiter) Pause(d time.Duration) {
+	if r == nil || d <= 0 {
+		return
+	}
+	r.mu.Lock()
+	if until := time.Now().Add(d); until.After(r.pausedUntil) {
+		r.pausedUntil = until
+	}
+	r.mu.Unlock()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(60, now) // one per second, burst of 60
+	if wait := b.reserve(60, now); wait != 0 {
+		t.Errorf("full bucket should not wait, got %v", wait)
+	}
+	if wait := b.reserve(2, now); wait != 2*time.Second {
+		t.Errorf("empty bucket should wait 2s for 2 units, got %v", wait)
+	}
+	if wait := b.reserve(1, now.Add(5*time.Second)); wait != 0 {
+		t.Errorf("bucket should have refilled, got %v", wait)
+	}
+	if wait := b.reserve(1000, now.Add(time.Hour)); wait != 0 {
+		t.Errorf("oversized requests should be clamped to one minute's worth, got %v", wait)
+	}
+	if newTokenBucket(0, now) != nil {
+		t.Error("zero rate should mean no bucket")
+	}
+}
+
+func TestRateLimiter_WaitAndPause(t *testing.T) {
+	r := newRateLimiter(0, 6000) // 100 tokens per second
+	ctx := context.Background()
+	if err := r.Wait(ctx, 6000); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := r.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected to wait ~100ms for tokens, waited %v", elapsed)
+	}
+
+	r = newRateLimiter(0, 0)
+	r.Pause(50 * time.Millisecond)
+	start = time.Now()
+	if err := r.Wait(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("pause not honored, waited %v", elapsed)
+	}
+
+	r.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := r.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context error, got %v", err)
+	}
+	var nilLimiter *rateLimiter
+	if err := nilLimiter.Wait(context.Background(), 1); err != nil {
+		t.Errorf("nil limiter should not block: %v", err)
+	}
+}
+
+func TestNewStatusError(t *testing.T) {
+	cases := []struct {
+		status    int
+		header    http.Header
+		body      string
+		message   string
+		retryable bool
+		after     time.Duration
+	}{
+		{429, http.Header{"Retry-After": {"3"}}, `{"error":{"type":"rate_limit","message":"slow down"}}`, "slow down", true, 3 * time.Second},
+		{500, http.Header{"Retry-After-Ms": {"1500"}}, `{"error":"model crashed"}`, "model crashed", true, 1500 * time.Millisecond},
+		{404, http.Header{}, `model not found`, "model not found", false, 0},
+		{401, http.Header{}, ``, "Unauthorized", false, 0},
+	}
+	for _, tc := range cases {
+		resp := &http.Response{StatusCode: tc.status, Header: tc.header, Body: http.NoBody}
+		if tc.body != "" {
+			resp.Body = readCloser{strings.NewReader(tc.body)}
+		}
+		perr := newStatusError("test", resp)
+		if perr.Message != tc.message || perr.Retryable != tc.retryable || perr.RetryAfter != tc.after {
+			t.Errorf("%d: got %+v", tc.status, perr)
+		}
+	}
+}
+
+func TestParseRetryAfter_HTTPDate(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}
+	if d := parseRetryAfter(h, now); d != 90*time.Second {
+		t.Errorf("expected 90s, got %v", d)
+	}
+}
+
+type readCloser struct{ *strings.Reader }
+
+func (readCloser) Close() error { return nil }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChunkResult is the outcome of reviewing a single chunk.
+type ChunkResult struct {
+	Index     int       `json:"index"`
+	Lang      string    `json:"lang"`
+	File      string    `json:"file"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Review    string    `json:"review,omitempty"`
+	Findings  []Finding `json:"findings,omitempty"`
+	Tests     string    `json:"tests,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Usage     Usage     `json:"usage"`
+	// Cached is set when the review was served from the ReviewCache.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Report collects chunk results across a run and renders them at the end.
+type Report struct {
+	Mode     string
+	Provider string
+	Model    string
+	Root     string
+	Started  time.Time
+	// Price, when set, is used to show estimated costs.
+	Price *Price
+
+	mu      sync.Mutex
+	results []ChunkResult
+}
+
+func NewReport(mode, provider, model string) *Report {
+	return &Report{Mode: mode, Provider: provider, Model: model, Started: time.Now()}
+}
+
+func (r *Report) Add(res ChunkResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+// Results returns the collected results ordered by language and chunk index.
+func (r *Report) Results() []ChunkResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ChunkResult, len(r.results))
+	copy(out, r.results)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Lang != out[j].Lang {
+			return out[i].Lang < out[j].Lang
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out
+}
+
+// WriteMarkdown renders the report as a single Markdown document.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	results := r.Results()
+	failed := r.FailedCount()
+	var b strings.Builder
+	b.WriteString("# Code Review Report\n\n")
+	fmt.Fprintf(&b, "- Mode: %s\n", r.Mode)
+	fmt.Fprintf(&b, "- Provider: %s | Model: %s\n", r.Provider, r.Model)
+	fmt.Fprintf(&b, "- Generated: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Chunks: %d reviewed, %d failed\n", len(results)-failed, failed)
+	usage := r.UsageSummary()
+	fmt.Fprintf(&b, "- Tokens: %s\n", formatUsage(usage.Total, r.Price))
+	for _, st := range r.ByLanguage() {
+		fmt.Fprintf(&b, "  - %s\n", st.format(r.Price))
+	}
+	for _, res := range results {
+		fmt.Fprintf(&b, "\n## Chunk %d [%s] %s\n\n", res.Index+1, res.Lang, res.location())
+		if res.Usage.Total() > 0 {
+			fmt.Fprintf(&b, "_Tokens: %s_\n\n", formatUsage(res.Usage, r.Price))
+		}
+		if res.Cached {
+			b.WriteString("_Review served from cache_\n\n")
+		}
+		if res.Error != "" {
+			fmt.Fprintf(&b, "> **Review failed:** %s\n", res.Error)
+			continue
+		}
+		if isJSONReview(res.Review) {
+			writeFindingsMarkdown(&b, res.Findings)
+		} else {
+			b.WriteString(strings.TrimSpace(res.Review))
+			b.WriteString("\n")
+		}
+		if res.Tests != "" {
+			b.WriteString("\n### Unit test suggestions\n\n")
+			b.WriteString(strings.TrimSpace(res.Tests))
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// LanguageStats summarizes the results of one language in a run.
+type LanguageStats struct {
+	Lang     string
+	Files    int
+	Chunks   int
+	Failed   int
+	Findings int
+	Usage    Usage
+}
+
+func (st LanguageStats) format(price *Price) string {
+	return fmt.Sprintf("%s: %d file(s), %d chunk(s), %d failed, %d finding(s); tokens: %s",
+		st.Lang, st.Files, st.Chunks, st.Failed, st.Findings, formatUsage(st.Usage, price))
+}
+
+// ByLanguage groups the results by language, in language order.
+func (r *Report) ByLanguage() []LanguageStats {
+	stats := map[string]*LanguageStats{}
+	files := map[string]map[string]bool{}
+	for _, res := range r.Results() {
+		st := stats[res.Lang]
+		if st == nil {
+			st = &LanguageStats{Lang: res.Lang}
+			stats[res.Lang] = st
+			files[res.Lang] = map[string]bool{}
+		}
+		files[res.Lang][res.File] = true
+		st.Files = len(files[res.Lang])
+		st.Chunks++
+		if res.Error != "" {
+			st.Failed++
+		}
+		st.Findings += len(res.Findings)
+		st.Usage.Add(res.Usage)
+	}
+	out := make([]LanguageStats, 0, len(stats))
+	for _, lang := range sortedKeys(stats) {
+		out = append(out, *stats[lang])
+	}
+	return out
+}
+
+// WriteLanguageSummary prints one line per language with its chunk, failure,
+// finding and token counts.
+func (r *Report) WriteLanguageSummary(w io.Writer) {
+	fmt.Fprintln(w, "\n===== SUMMARY by language =====")
+	for _, st := range r.ByLanguage() {
+		fmt.Fprintln(w, st.format(r.Price))
+	}
+}
+
+// Findings returns every finding across all chunks, in report order.
+func (r *Report) Findings() []Finding {
+	findings := []Finding{}
+	for _, res := range r.Results() {
+		findings = append(findings, res.Findings...)
+	}
+	return findings
+}
+
+// FailedCount returns the number of chunks that could not be reviewed.
+func (r *Report) FailedCount() int {
+	n := 0
+	for _, res := range r.Results() {
+		if res.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// CountAtLeast returns the number of findings at or above the given severity.
+func (r *Report) CountAtLeast(severity string) int {
+	n := 0
+	for _, f := range r.Findings() {
+		if severityAtLeast(f.Severity, severity) {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteJSON writes the findings array as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Findings())
+}
+
+// Write renders the report in the given format: markdown, json or sarif.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "markdown":
+		return r.WriteMarkdown(w)
+	case "json":
+		return r.WriteJSON(w)
+	case "sarif":
+		return r.WriteSARIF(w)
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+// WriteFile writes the report to path in the given format.
+func (r *Report) WriteFile(path, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeFindingsMarkdown(b *strings.Builder, findings []Finding) {
+	if len(findings) == 0 {
+		b.WriteString("No issues found.\n")
+		return
+	}
+	for _, f := range findings {
+		note := ""
+		if f.OutOfRange {
+			note = " _(cited lines are outside the reviewed change)_"
+		}
+		fmt.Fprintf(b, "- **%s** (%s) `%s:%d-%d`%s: %s\n", f.Severity, f.Category, f.File, f.StartLine, f.EndLine, note, f.Message)
+		if f.SuggestedFix != "" {
+			fmt.Fprintf(b, "  - Suggested fix: %s\n", f.SuggestedFix)
+		}
+	}
+}
+
+func (res ChunkResult) location() string {
+	if res.StartLine == 0 && res.File != "" {
+		return fmt.Sprintf("`%s`", res.File)
+	}
+	if res.File == "" {
+		return fmt.Sprintf("lines %d-%d", res.StartLine, res.EndLine)
+	}
+	return fmt.Sprintf("`%s:%d-%d`", res.File, res.StartLine, res.EndLine)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReport_WriteMarkdown(t *testing.T) {
+	r := NewReport("review-file", "openai", "gpt-4o")
+	r.Add(ChunkResult{Index: 1, Lang: "go", File: "main.go", StartLine: 11, EndLine: 20, Error: "context deadline exceeded"})
+	r.Add(ChunkResult{Index: 0, Lang: "go", File: "main.go", StartLine: 1, EndLine: 10, Review: "Looks fine.", Tests: "```go\n```"})
+
+	var buf bytes.Buffer
+	if err := r.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Chunks: 1 reviewed, 1 failed", "## Chunk 1 [go] `main.go:1-10`", "Looks fine.", "**Review failed:** context deadline exceeded"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "Chunk 1 ") > strings.Index(out, "Chunk 2 ") {
+		t.Error("chunks not ordered by index")
+	}
+}
+
+func TestReport_ByLanguage(t *testing.T) {
+	r := NewReport("diff-branch", "openai", "gpt-4o")
+	r.Add(ChunkResult{Index: 0, Lang: "php", File: "a.php", Findings: []Finding{{}, {}}})
+	r.Add(ChunkResult{Index: 0, Lang: "go", File: "a.go"})
+	r.Add(ChunkResult{Index: 1, Lang: "go", File: "a.go", Error: "timeout"})
+	r.Add(ChunkResult{Index: 2, Lang: "go", File: "b.go", Findings: []Finding{{}}})
+	stats := r.ByLanguage()
+	want := []LanguageStats{
+		{Lang: "go", Files: 2, Chunks: 3, Failed: 1, Findings: 1},
+		{Lang: "php", Files: 1, Chunks: 1, Findings: 2},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("expected %d languages, got %+v", len(want), stats)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("got %+v, want %+v", stats[i], want[i])
+		}
+	}
+}
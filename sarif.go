@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifRootID  = "%SRCROOT%"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                   `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLoc `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult               `json:"results"`
+	Properties         map[string]interface{}      `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                 `json:"name"`
+	InformationURI string                 `json:"informationUri,omitempty"`
+	Rules          []sarifRule            `json:"rules"`
+	Properties     map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLoc `json:"artifactLocation"`
+	Region           *sarifRegion     `json:"region,omitempty"`
+}
+
+type sarifArtifactLoc struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+var categoryDescriptions = map[string]string{
+	CategoryCorrectness: "Correctness, maintainability and bug risks",
+	CategorySecurity:    "Security vulnerabilities and unsafe patterns",
+	CategoryPerformance: "Performance, memory and resource management",
+	CategoryTesting:     "Test coverage and test quality",
+}
+
+// WriteSARIF writes the findings as a SARIF 2.1.0 log with one rule per category.
+func (r *Report) WriteSARIF(w io.Writer) error {
+	var rules []sarifRule
+	ruleIndex := map[string]int{}
+	for i, cat := range categories {
+		ruleIndex[cat] = i
+		rules = append(rules, sarifRule{
+			ID:               "reviewer/" + cat,
+			Name:             cat,
+			ShortDescription: sarifMessage{Text: categoryDescriptions[cat]},
+		})
+	}
+	results := []sarifResult{}
+	for _, f := range r.Findings() {
+		res := sarifResult{
+			RuleID:    "reviewer/" + f.Category,
+			RuleIndex: ruleIndex[f.Category],
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+			Properties: map[string]interface{}{
+				"severity": f.Severity,
+			},
+		}
+		if f.SuggestedFix != "" {
+			res.Properties["suggestedFix"] = f.SuggestedFix
+		}
+		if f.OutOfRange {
+			res.Properties["outOfRange"] = true
+			res.Properties["citedLines"] = fmt.Sprintf("%d-%d", f.StartLine, f.EndLine)
+		}
+		if f.File != "" {
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLoc{URI: r.relativeURI(f.File), URIBaseID: sarifRootID},
+			}}
+			if f.StartLine > 0 && !f.OutOfRange {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.StartLine, EndLine: f.EndLine}
+			}
+			res.Locations = []sarifLocation{loc}
+		}
+		results = append(results, res)
+	}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "reviewer",
+			InformationURI: "https://github.com/disconnekt/reviwer",
+			Rules:          rules,
+			Properties: map[string]interface{}{
+				"provider": r.Provider,
+				"model":    r.Model,
+			},
+		}},
+		Results:    results,
+		Properties: map[string]interface{}{"mode": r.Mode, "usage": r.UsageSummary()},
+	}
+	if root, err := filepath.Abs(r.Root); err == nil {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLoc{
+			sarifRootID: {URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(root) + "/"}).String()},
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}})
+}
+
+// relativeURI maps a finding path to a forward-slash path relative to the report root.
+func (r *Report) relativeURI(path string) string {
+	root, err := filepath.Abs(r.Root)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(path))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(path))
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case SeverityCritical, SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestReport_WriteSARIF(t *testing.T) {
+	r := NewReport("review-project", "lmstudio", "google/gemma-3-12b")
+	r.Root = "proj"
+	r.Add(ChunkResult{Index: 0, Lang: "go", File: "proj/pkg/db.go", Findings: []Finding{
+		{File: "proj/pkg/db.go", StartLine: 10, EndLine: 12, Severity: SeverityCritical, Category: CategorySecurity, Message: "SQL injection"},
+		{File: "proj/pkg/db.go", Severity: SeverityLow, Category: CategoryTesting, Message: "missing test"},
+	}})
+
+	var buf bytes.Buffer
+	if err := r.WriteSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Properties["model"] != "google/gemma-3-12b" || len(run.Tool.Driver.Rules) != len(categories) {
+		t.Errorf("unexpected driver: %+v", run.Tool.Driver)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(run.Results))
+	}
+	first := run.Results[0]
+	if first.RuleID != "reviewer/security" || first.Level != "error" || run.Tool.Driver.Rules[first.RuleIndex].ID != first.RuleID {
+		t.Errorf("unexpected first result: %+v", first)
+	}
+	loc := first.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "pkg/db.go" || loc.Region == nil || loc.Region.StartLine != 10 || loc.Region.EndLine != 12 {
+		t.Errorf("unexpected location: %+v", loc)
+	}
+	if run.Results[1].Level != "note" || run.Results[1].Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("unexpected second result: %+v", run.Results[1])
+	}
+}
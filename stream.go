@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errIdleTimeout is the cancellation cause when a streaming reply stalls. It wraps
+// context.DeadlineExceeded so timeout handling treats it like a request deadline.
+var errIdleTimeout = fmt.Errorf("no tokens received within idle timeout: %w", context.DeadlineExceeded)
+
+// idleWatchdog cancels its context when touch is not called for the configured duration.
+type idleWatchdog struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	d     time.Duration
+}
+
+type watchdogKey struct{}
+
+// withIdleTimeout returns a context that is cancelled with errIdleTimeout once no
+// activity has been reported via touchIdle for d.
+func withIdleTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	w := &idleWatchdog{d: d}
+	w.timer = time.AfterFunc(d, func() { cancel(errIdleTimeout) })
+	ctx = context.WithValue(ctx, watchdogKey{}, w)
+	return ctx, func() {
+		w.timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// touchIdle resets the idle timer attached to ctx, if any.
+func touchIdle(ctx context.Context) {
+	w, ok := ctx.Value(watchdogKey{}).(*idleWatchdog)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	w.timer.Reset(w.d)
+	w.mu.Unlock()
+}
+
+// idleCause returns errIdleTimeout if ctx was cancelled by its watchdog, else err.
+func idleCause(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errIdleTimeout) {
+		return errIdleTimeout
+	}
+	return err
+}
+
+// readSSE calls fn with the payload of every "data:" line of a server-sent event
+// stream until the stream ends or the "[DONE]" sentinel is received.
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+		if err := fn([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStreamingLMStudio returns a client for a server that streams "Looks good" with
+// stall between tokens. Request bodies are sent to bodies.
+func newStreamingLMStudio(t *testing.T, stall time.Duration, bodies chan<- string) *LLMClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		select {
+		case bodies <- string(b):
+		default:
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, tok := range []string{"Looks", " good"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", tok)
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(stall):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	p, err := newLMStudioProvider(&Config{LLMModel: "m", LLM: LLMConfig{BaseURL: srv.URL}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &LLMClient{provider: p}
+}
+
+func streamTestRequest() ChatRequest {
+	lc := LanguageConfig{Name: "typescript", Fence: "ts", ReviewPrompt: "sys"}
+	return reviewRequest(lc, Chunk{File: "a.ts", StartLine: 1, EndLine: 1, Content: "code"}, 256, false)
+}
+
+func TestStreaming_CollectsTokens(t *testing.T) {
+	bodies := make(chan string, 1)
+	l := newStreamingLMStudio(t, 10*time.Millisecond, bodies)
+	var out bytes.Buffer
+	l.EnableStreaming(&out)
+	opts := ReviewOptions{ChunkTimeout: time.Second, MaxRetries: 1}
+	resp, err := l.retryChunk(context.Background(), opts, 0, streamTestRequest(), "Review:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Looks good" {
+		t.Errorf("review = %q", resp.Content)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("Looks good")) {
+		t.Errorf("streamed output missing tokens: %q", out.String())
+	}
+	if body := <-bodies; !strings.Contains(body, "```ts") {
+		t.Errorf("request should fence the code with the language's fence tag: %s", body)
+	}
+}
+
+func TestStreaming_IdleTimeout(t *testing.T) {
+	l := newStreamingLMStudio(t, time.Second, nil)
+	l.EnableStreaming(&bytes.Buffer{})
+	opts := ReviewOptions{ChunkTimeout: 100 * time.Millisecond, MaxRetries: 1}
+	_, err := l.retryChunk(context.Background(), opts, 0, streamTestRequest(), "Review:")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected idle timeout, got %v", err)
+	}
+}
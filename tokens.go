@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// defaultCharsPerToken is a calibrated estimate of source-code bytes per token for
+// common BPE tokenizers (OpenAI o200k/cl100k, Llama, Gemma). Prose runs closer to
+// 4; dense code with short identifiers runs closer to 3.
+const defaultCharsPerToken = 3.5
+
+// Prompt framing not covered by the configured prompts: the intro line, code fence,
+// gutter note and chat template tokens.
+const promptFramingTokens = 200
+
+// gutterChars is the width of the "%5d| " line-number gutter added by Annotated.
+const gutterChars = 7
+
+// tokenSafetyMargin is the share of the chunk token budget kept free to absorb
+// estimation error.
+const tokenSafetyMargin = 0.1
+
+// minChunkTokens keeps a misconfigured context window from shrinking chunks to nothing.
+const minChunkTokens = 256
+
+// ModelLimits describes a model's token limits. Configure it per model in the
+// [models] section of config.toml.
+type ModelLimits struct {
+	ContextWindow   int     `toml:"context_window"`
+	MaxOutputTokens int     `toml:"max_output_tokens"`
+	CharsPerToken   float64 `toml:"chars_per_token"`
+}
+
+// EstimateTokens estimates the number of tokens in s.
+func (m ModelLimits) EstimateTokens(s string) int {
+	return estimateTokens(len(s), m.CharsPerToken)
+}
+
+func estimateTokens(chars int, charsPerToken float64) int {
+	if charsPerToken <= 0 {
+		charsPerToken = defaultCharsPerToken
+	}
+	return int(math.Ceil(float64(chars) / charsPerToken))
+}
+
+// ModelLimits returns the limits configured for the selected model, filling in
+// defaults. Without a configured context_window, the ollama provider falls back to
+// [ollama] num_ctx, which is where Ollama truncates prompts.
+func (c *Config) ModelLimits() ModelLimits {
+	m := c.Models[c.modelName()]
+	if m.ContextWindow == 0 && c.LLMProvider == "ollama" {
+		m.ContextWindow = c.Ollama.NumCtx
+	}
+	if m.MaxOutputTokens <= 0 {
+		m.MaxOutputTokens = defaultMaxTokens
+	}
+	if m.CharsPerToken <= 0 {
+		m.CharsPerToken = defaultCharsPerToken
+	}
+	return m
+}
+
+// ChunkBudget bounds the size of a chunk in lines and, when Tokens is set, in
+// estimated tokens of code.
+type ChunkBudget struct {
+	Lines         int
+	Tokens        int
+	CharsPerToken float64
+}
+
+// ChunkBudget returns the chunk size limits for the selected model: chunk_size
+// lines, further limited so that the largest configured prompt, the chunk and the
+// reply fit in the model's context window.
+func (c *Config) ChunkBudget() ChunkBudget {
+	m := c.ModelLimits()
+	b := ChunkBudget{Lines: c.ChunkSize, CharsPerToken: m.CharsPerToken}
+	if m.ContextWindow <= 0 {
+		return b
+	}
+	prompt := len(findingsInstruction)
+	for _, lc := range c.Languages {
+		prompt = max(prompt, len(lc.ReviewPrompt)+len(findingsInstruction), len(lc.TestPrompt))
+	}
+	free := m.ContextWindow - m.MaxOutputTokens - m.EstimateTokens(gutterNote) -
+		estimateTokens(prompt, m.CharsPerToken) - promptFramingTokens
+	b.Tokens = max(int(float64(free)*(1-tokenSafetyMargin)), minChunkTokens)
+	return b
+}
+
+// LinesFor returns how many lines of a text with the given size fit in the budget,
+// based on the text's average line length. Texts with very uneven lines may still
+// produce chunks over budget; LLMClient warns when a request would overflow.
+func (b ChunkBudget) LinesFor(chars, lines int) int {
+	n := b.Lines
+	if b.Tokens > 0 && lines > 0 {
+		perLine := float64(estimateTokens(chars+gutterChars*lines, b.CharsPerToken)) / float64(lines)
+		if t := int(float64(b.Tokens) / perLine); n <= 0 || t < n {
+			n = t
+		}
+	}
+	if n <= 0 {
+		if b.Lines <= 0 && b.Tokens <= 0 {
+			return math.MaxInt32
+		}
+		n = 1
+	}
+	return n
+}
+
+// warnOverflow reports a request that likely does not fit in the model's context
+// window, since most backends truncate the prompt silently instead of failing.
+func (l *LLMClient) warnOverflow(req ChatRequest, title string) {
+	if l.limits.ContextWindow <= 0 {
+		return
+	}
+	prompt := l.limits.EstimateTokens(req.System) + l.limits.EstimateTokens(req.User)
+	if prompt+req.MaxTokens > l.limits.ContextWindow {
+		fmt.Fprintf(os.Stderr, "[!] %s prompt is ~%d tokens plus %d reply tokens, over the %d-token context window of %s; the model may truncate it\n",
+			title, prompt, req.MaxTokens, l.limits.ContextWindow, l.provider.Model())
+	}
+}
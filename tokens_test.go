@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_ModelLimits(t *testing.T) {
+	cfg := &Config{
+		LLMProvider: "lmstudio",
+		Model:       "gpt-4o",
+		LLMModel:    "gemma",
+		Models:      map[string]ModelLimits{"gemma": {ContextWindow: 8192}},
+	}
+	m := cfg.ModelLimits()
+	if m.ContextWindow != 8192 || m.MaxOutputTokens != defaultMaxTokens || m.CharsPerToken != defaultCharsPerToken {
+		t.Errorf("unexpected limits: %+v", m)
+	}
+
+	cfg = &Config{LLMProvider: "ollama", LLMModel: "llama3", Ollama: OllamaConfig{NumCtx: 4096}}
+	if m := cfg.ModelLimits(); m.ContextWindow != 4096 {
+		t.Errorf("ollama should fall back to num_ctx, got %+v", m)
+	}
+}
+
+func TestChunkBudget_LinesFor(t *testing.T) {
+	if n := (ChunkBudget{Lines: 100}).LinesFor(1e6, 10); n != 100 {
+		t.Errorf("line-only budget should ignore size, got %d", n)
+	}
+	// 40 lines of 28 bytes plus a 7-byte gutter are 1400 bytes, ~10 tokens per line.
+	b := ChunkBudget{Lines: 1200, Tokens: 100, CharsPerToken: 3.5}
+	if n := b.LinesFor(40*28, 40); n != 10 {
+		t.Errorf("expected 10 lines, got %d", n)
+	}
+	if n := (ChunkBudget{Lines: 5, Tokens: 1000}).LinesFor(100, 10); n != 5 {
+		t.Errorf("chunk_size should stay an upper bound, got %d", n)
+	}
+	if n := (ChunkBudget{Tokens: 1}).LinesFor(1000, 1); n != 1 {
+		t.Errorf("budget should never drop below one line, got %d", n)
+	}
+}
+
+func TestConfig_ChunkBudgetReservesPromptAndReply(t *testing.T) {
+	cfg := &Config{
+		ChunkSize: 1200,
+		LLMModel:  "small",
+		Models:    map[string]ModelLimits{"small": {ContextWindow: 8192, MaxOutputTokens: 1024}},
+		Languages: map[string]LanguageConfig{"go": {ReviewPrompt: strings.Repeat("x", 3500)}},
+	}
+	b := cfg.ChunkBudget()
+	if b.Tokens <= minChunkTokens || b.Tokens >= 8192-1024-1000 {
+		t.Errorf("budget should leave room for reply and prompt, got %d", b.Tokens)
+	}
+	cfg.Models = nil
+	if b := cfg.ChunkBudget(); b.Tokens != 0 || b.Lines != 1200 {
+		t.Errorf("unknown model should fall back to lines, got %+v", b)
+	}
+}
+
+func TestGetFileChunks_TokenBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	line := strings.Repeat("y", 63)
+	if err := os.WriteFile(path, []byte(strings.Repeat(line+"\n", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Each line costs just over 20 tokens with its gutter, so 100 tokens hold 4 lines.
+	chunks, err := GetFileChunks(path, ChunkBudget{Lines: 1200, Tokens: 100, CharsPerToken: 3.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 26 || chunks[0].EndLine != 4 {
+		t.Errorf("expected token-sized chunks, got %d chunks, first ends at %d", len(chunks), chunks[0].EndLine)
+	}
+}
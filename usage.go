@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Usage counts the tokens consumed by LLM requests.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// Estimated is set when a backend did not report usage for some request and
+	// its tokens were estimated from the text.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Add accumulates o into u.
+func (u *Usage) Add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.Estimated = u.Estimated || o.Estimated
+}
+
+// Total returns prompt plus completion tokens.
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u Usage) String() string {
+	s := fmt.Sprintf("%d prompt + %d completion = %d tokens", u.PromptTokens, u.CompletionTokens, u.Total())
+	if u.Estimated {
+		s += " (partly estimated)"
+	}
+	return s
+}
+
+// Price is what a model costs in USD per million tokens. Configure it per model in
+// the [prices] section of config.toml.
+type Price struct {
+	Input  float64 `toml:"input_per_mtok" json:"input_per_mtok"`
+	Output float64 `toml:"output_per_mtok" json:"output_per_mtok"`
+}
+
+// Cost returns the estimated cost of u in USD.
+func (p Price) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// Price returns the configured price of the selected model, if any.
+func (c *Config) Price() (Price, bool) {
+	p, ok := c.Prices[c.modelName()]
+	return p, ok
+}
+
+// modelName is the model requests go to. OpenAI uses model, as it always has, so
+// an llm_model meant for a local backend is not sent to OpenAI; --llm-model sets
+// both. Other providers use llm_model, or model when it is unset.
+func (c *Config) modelName() string {
+	if (c.LLMProvider == "" || c.LLMProvider == "openai") && c.Model != "" {
+		return c.Model
+	}
+	if c.LLMModel != "" {
+		return c.LLMModel
+	}
+	return c.Model
+}
+
+// formatUsage renders usage with its cost when a price is known.
+func formatUsage(u Usage, price *Price) string {
+	if price == nil {
+		return u.String()
+	}
+	return fmt.Sprintf("%s, ~$%.4f", u, price.Cost(u))
+}
+
+// ChunkUsage is the token usage of one chunk in a UsageSummary.
+type ChunkUsage struct {
+	Index   int      `json:"index"`
+	Lang    string   `json:"lang"`
+	File    string   `json:"file"`
+	Usage   Usage    `json:"usage"`
+	CostUSD *float64 `json:"cost_usd,omitempty"`
+}
+
+// UsageSummary is the machine-readable token and cost accounting of a run. Costs
+// are only set when the model has a configured price.
+type UsageSummary struct {
+	Total   Usage            `json:"total"`
+	CostUSD *float64         `json:"cost_usd,omitempty"`
+	Price   *Price           `json:"price,omitempty"`
+	ByLang  map[string]Usage `json:"by_language"`
+	Chunks  []ChunkUsage     `json:"chunks"`
+}
+
+// Usage returns the token usage summed over all chunks.
+func (r *Report) Usage() Usage {
+	var total Usage
+	for _, res := range r.Results() {
+		total.Add(res.Usage)
+	}
+	return total
+}
+
+// Cost returns the estimated cost of the run in USD, or 0 without a price.
+func (r *Report) Cost() float64 {
+	if r.Price == nil {
+		return 0
+	}
+	return r.Price.Cost(r.Usage())
+}
+
+// UsageSummary aggregates token usage per chunk, per language and for the run.
+func (r *Report) UsageSummary() UsageSummary {
+	s := UsageSummary{Price: r.Price, ByLang: map[string]Usage{}, Chunks: []ChunkUsage{}}
+	cost := func(u Usage) *float64 {
+		if r.Price == nil {
+			return nil
+		}
+		c := r.Price.Cost(u)
+		return &c
+	}
+	for _, res := range r.Results() {
+		s.Total.Add(res.Usage)
+		lang := s.ByLang[res.Lang]
+		lang.Add(res.Usage)
+		s.ByLang[res.Lang] = lang
+		s.Chunks = append(s.Chunks, ChunkUsage{Index: res.Index, Lang: res.Lang, File: res.File, Usage: res.Usage, CostUSD: cost(res.Usage)})
+	}
+	s.CostUSD = cost(s.Total)
+	return s
+}
+
+// WriteUsageFile writes the usage summary to path as indented JSON.
+func (r *Report) WriteUsageFile(path string) error {
+	b, err := json.MarshalIndent(r.UsageSummary(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReport_UsageSummary(t *testing.T) {
+	r := NewReport("test", "fake", "m")
+	r.Add(ChunkResult{Index: 0, Lang: "go", Usage: Usage{PromptTokens: 1000, CompletionTokens: 100}})
+	r.Add(ChunkResult{Index: 1, Lang: "go", Usage: Usage{PromptTokens: 500, CompletionTokens: 50, Estimated: true}})
+	r.Add(ChunkResult{Index: 0, Lang: "php", Usage: Usage{PromptTokens: 2000, CompletionTokens: 200}})
+	s := r.UsageSummary()
+	if s.Total != (Usage{PromptTokens: 3500, CompletionTokens: 350, Estimated: true}) {
+		t.Errorf("unexpected total: %+v", s.Total)
+	}
+	if s.ByLang["go"].Total() != 1650 || s.ByLang["php"].Total() != 2200 || len(s.Chunks) != 3 {
+		t.Errorf("unexpected breakdown: %+v", s)
+	}
+	if s.CostUSD != nil || r.Cost() != 0 {
+		t.Errorf("cost should be unset without a price")
+	}
+	r.Price = &Price{Input: 2.5, Output: 10}
+	if got, want := r.Cost(), (3500*2.5+350*10)/1e6; got != want {
+		t.Errorf("cost = %v, want %v", got, want)
+	}
+}
+
+func TestReviewAndFixLoop_MaxCostStopsRun(t *testing.T) {
+	old := progressOut
+	progressOut = io.Discard
+	t.Cleanup(func() { progressOut = old })
+	p := &fakeProvider{delay: func(string) time.Duration { return time.Millisecond }}
+	l := &LLMClient{provider: p}
+	var chunks []Chunk
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, Chunk{Content: fmt.Sprintf("code-%d", i)})
+	}
+	report := NewReport("test", "fake", "fake-model")
+	// Every chunk costs 2 requests * (100 in + 10 out) tokens = $0.00024 at $1/$2 per Mtok.
+	report.Price = &Price{Input: 1, Output: 2}
+	opts := ReviewOptions{ChunkTimeout: time.Second, MaxRetries: 1, Concurrency: 1, MaxCost: 0.0005}
+	err := l.ReviewAndFixLoop(context.Background(), testLoopConfig(), "go", chunks, opts, report)
+	if !errors.Is(err, ErrCostBudgetExceeded) {
+		t.Fatalf("expected cost budget error, got %v", err)
+	}
+	if n := len(report.Results()); n != 3 {
+		t.Errorf("expected the run to stop after 3 chunks, got %d", n)
+	}
+}
+
+func TestLMStudio_StreamUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":1}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	p, err := newLMStudioProvider(&Config{LLMModel: "m", LLM: LLMConfig{BaseURL: srv.URL}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := p.(StreamingProvider).ChatStream(context.Background(), ChatRequest{System: "s", User: "u"}, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "ok" || resp.Usage != (Usage{PromptTokens: 30, CompletionTokens: 1}) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}